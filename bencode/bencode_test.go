@@ -0,0 +1,106 @@
+package bencode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	for data, want := range map[string]interface{}{
+		"i42e":                    int64(42),
+		"i-7e":                    int64(-7),
+		"4:spam":                  "spam",
+		"0:":                      "",
+		"le":                      []interface{}{},
+		"l4:spami42ee":            []interface{}{"spam", int64(42)},
+		"d3:cow3:moo4:spaml1:aee": map[string]interface{}{"cow": "moo", "spam": []interface{}{"a"}},
+	} {
+		v, err := Decode([]byte(data))
+		require.NoError(t, err, data)
+		require.Equal(t, want, v, data)
+	}
+
+	for _, data := range []string{
+		"", "i42", "iabce", "5:spam", "l4:spam", "d3:cowe", "di1e3:mooe", "x", "i1ei2e",
+		"9223372036854775807:x", "l9223372036854775806:xe", "99999999999999999999:x",
+		strings.Repeat("l", MaxDepth+1) + strings.Repeat("e", MaxDepth+1),
+	} {
+		_, err := Decode([]byte(data))
+		require.Error(t, err, data)
+	}
+	_, err := Decode([]byte(strings.Repeat("l", MaxDepth) + strings.Repeat("e", MaxDepth)))
+	require.NoError(t, err)
+}
+
+func TestRawValue(t *testing.T) {
+	data := []byte("d8:announce3:url4:infod4:name4:testee")
+	raw, err := RawValue(data, "info")
+	require.NoError(t, err)
+	require.Equal(t, "d4:name4:teste", string(raw))
+
+	_, err = RawValue(data, "missing")
+	require.Error(t, err)
+}
+
+func TestMarshal(t *testing.T) {
+	type file struct {
+		Length int64    `bencode:"length"`
+		Path   []string `bencode:"path"`
+		Attr   string   `bencode:"attr,omitempty"`
+	}
+	type info struct {
+		Name        string     `bencode:"name"`
+		PieceLength int        `bencode:"piece length"`
+		Files       []file     `bencode:"files"`
+		Private     bool       `bencode:"private,omitempty"`
+		Pieces      [4]byte    `bencode:"pieces"`
+		Ignored     string     `bencode:"-"`
+		Raw         RawMessage `bencode:"raw,omitempty"`
+		unexported  int
+	}
+
+	for want, v := range map[string]interface{}{
+		"i42e":                   42,
+		"i-7e":                   int8(-7),
+		"i18446744073709551615e": uint64(1<<64 - 1),
+		"i1e":                    true,
+		"4:spam":                 "spam",
+		"3:abc":                  []byte("abc"),
+		"l4:spami42ee":           []interface{}{"spam", 42},
+		"d1:ai1e1:bi2ee":         map[string]int{"b": 2, "a": 1},
+		"d5:filesld6:lengthi5e4:pathl1:a1:beed4:attr1:p6:lengthi3e4:pathl4:.padeee4:name4:test12:piece lengthi16e6:pieces4:\x01\x02\x03\x043:rawd1:xi1eee": info{
+			Name:        "test",
+			PieceLength: 16,
+			Files:       []file{{Length: 5, Path: []string{"a", "b"}}, {Length: 3, Path: []string{".pad"}, Attr: "p"}},
+			Pieces:      [4]byte{1, 2, 3, 4},
+			Ignored:     "ignored",
+			Raw:         RawMessage("d1:xi1ee"),
+		},
+	} {
+		data, err := Marshal(v)
+		require.NoError(t, err, want)
+		require.Equal(t, want, string(data))
+	}
+
+	// decoding and encoding again gives the same data
+	data := []byte("d8:announce3:url4:infod5:filesld6:lengthi5e4:pathl1:aeee4:name4:testee")
+	v, err := Decode(data)
+	require.NoError(t, err)
+	encoded, err := Marshal(v)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(encoded))
+
+	for _, v := range []interface{}{
+		nil,
+		1.5,
+		map[int]string{1: "a"},
+		[]interface{}{"a", nil},
+		map[string]interface{}{"a": (*int)(nil)},
+		RawMessage("i1"),
+	} {
+		_, err := Marshal(v)
+		require.Error(t, err, "%#v", v)
+	}
+}
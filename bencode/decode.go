@@ -0,0 +1,162 @@
+// Package bencode implements the bencoding used by .torrent files and the BitTorrent protocol, see BEP 3.
+//
+// Decode returns generic values, Marshal encodes Go values including structs:
+//  type Info struct {
+//      Name   string `bencode:"name"`
+//      Length int64  `bencode:"length,omitempty"`
+//  }
+package bencode
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// MaxDepth is the deepest nesting of lists and dictionaries Decode accepts
+const MaxDepth = 512
+
+// Decode decodes a single bencoded value.
+// Integers are returned as int64, strings as string, lists as []interface{}
+// and dictionaries as map[string]interface{}.
+func Decode(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, errors.Errorf("bencode: trailing data at offset %d", d.pos)
+	}
+	return v, nil
+}
+
+// RawValue returns the raw encoding of the value stored under key in the top level dictionary of data.
+// This is used to hash the info dictionary of a .torrent file exactly as it was encoded.
+func RawValue(data []byte, key string) ([]byte, error) {
+	d := &decoder{data: data}
+	if err := d.expect('d'); err != nil {
+		return nil, err
+	}
+	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		k, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		start := d.pos
+		if _, err := d.value(); err != nil {
+			return nil, err
+		}
+		if k == key {
+			return d.data[start:d.pos], nil
+		}
+	}
+	return nil, errors.Errorf("bencode: key %q not found", key)
+}
+
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (d *decoder) expect(c byte) error {
+	if d.pos >= len(d.data) {
+		return errors.Errorf("bencode: unexpected end of data, expected %q", c)
+	}
+	if d.data[d.pos] != c {
+		return errors.Errorf("bencode: expected %q at offset %d, found %q", c, d.pos, d.data[d.pos])
+	}
+	d.pos++
+	return nil
+}
+
+func (d *decoder) value() (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, errors.New("bencode: unexpected end of data")
+	}
+	switch c := d.data[d.pos]; {
+	case c == 'l' || c == 'd':
+		if d.depth >= MaxDepth {
+			return nil, errors.Errorf("bencode: nesting exceeds %d levels at offset %d", MaxDepth, d.pos)
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+		if c == 'l' {
+			return d.list()
+		}
+		return d.dict()
+	case c == 'i':
+		d.pos++
+		end := d.index('e')
+		if end < 0 {
+			return nil, errors.Errorf("bencode: unterminated integer at offset %d", d.pos)
+		}
+		i, err := strconv.ParseInt(string(d.data[d.pos:end]), 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bencode: invalid integer at offset %d", d.pos)
+		}
+		d.pos = end + 1
+		return i, nil
+	case c >= '0' && c <= '9':
+		return d.str()
+	default:
+		return nil, errors.Errorf("bencode: unexpected %q at offset %d", c, d.pos)
+	}
+}
+
+func (d *decoder) list() ([]interface{}, error) {
+	d.pos++
+	list := []interface{}{}
+	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, d.expect('e')
+}
+
+func (d *decoder) dict() (map[string]interface{}, error) {
+	d.pos++
+	dict := map[string]interface{}{}
+	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		k, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		dict[k] = v
+	}
+	return dict, d.expect('e')
+}
+
+func (d *decoder) str() (string, error) {
+	colon := d.index(':')
+	if colon < 0 {
+		return "", errors.Errorf("bencode: invalid string at offset %d", d.pos)
+	}
+	n, err := strconv.Atoi(string(d.data[d.pos:colon]))
+	if err != nil || n < 0 {
+		return "", errors.Errorf("bencode: invalid string length at offset %d", d.pos)
+	}
+	start := colon + 1
+	if n > len(d.data)-start {
+		return "", errors.Errorf("bencode: string at offset %d exceeds data", d.pos)
+	}
+	d.pos = start + n
+	return string(d.data[start:d.pos]), nil
+}
+
+func (d *decoder) index(c byte) int {
+	for i := d.pos; i < len(d.data); i++ {
+		if d.data[i] == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,167 @@
+package bencode
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RawMessage is an encoded value which Marshal writes as is, e.g. an info dictionary returned by RawValue
+type RawMessage []byte
+
+var rawMessageType = reflect.TypeOf(RawMessage(nil))
+
+// Marshal returns the bencoding of v.
+//
+// Integers and booleans (as 0 or 1) are encoded as integers, strings and []byte as strings,
+// slices and arrays as lists, and maps with string keys as well as structs as dictionaries with sorted keys.
+// Struct fields are named by their `bencode` tag, or their name if they have none. The "omitempty" option
+// skips zero values and the tag "-" skips the field. Nil values can't be encoded, as bencode has no null.
+func Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := encode(&b, reflect.ValueOf(v), "value"); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func encode(b *bytes.Buffer, v reflect.Value, path string) error {
+	if !v.IsValid() {
+		return errors.Errorf("bencode: can't encode nil %s", path)
+	}
+	if v.Type() == rawMessageType {
+		if _, err := Decode(v.Bytes()); err != nil {
+			return errors.Wrapf(err, "bencode: invalid RawMessage %s", path)
+		}
+		b.Write(v.Bytes())
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return errors.Errorf("bencode: can't encode nil %s", path)
+		}
+		return encode(b, v.Elem(), path)
+	case reflect.Bool:
+		if v.Bool() {
+			b.WriteString("i1e")
+		} else {
+			b.WriteString("i0e")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteByte('i')
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+		b.WriteByte('e')
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteByte('i')
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+		b.WriteByte('e')
+	case reflect.String:
+		writeString(b, v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice {
+				writeString(b, string(v.Bytes()))
+				return nil
+			}
+			bs := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(bs), v)
+			writeString(b, string(bs))
+			return nil
+		}
+		b.WriteByte('l')
+		for i := 0; i < v.Len(); i++ {
+			if err := encode(b, v.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('e')
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return errors.Errorf("bencode: can't encode %s of type %s, dictionary keys must be strings", path, v.Type())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		b.WriteByte('d')
+		for _, k := range keys {
+			writeString(b, k.String())
+			if err := encode(b, v.MapIndex(k), path+"."+k.String()); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('e')
+	case reflect.Struct:
+		return encodeStruct(b, v, path)
+	default:
+		return errors.Errorf("bencode: can't encode %s of type %s", path, v.Type())
+	}
+	return nil
+}
+
+type structField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+func encodeStruct(b *bytes.Buffer, v reflect.Value, path string) error {
+	t := v.Type()
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("bencode")
+		if tag == "-" {
+			continue
+		}
+		f := structField{name: sf.Name, index: i}
+		if tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				f.name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				f.omitEmpty = f.omitEmpty || opt == "omitempty"
+			}
+		}
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+
+	b.WriteByte('d')
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		if f.omitEmpty && isEmpty(fv) {
+			continue
+		}
+		writeString(b, f.name)
+		if err := encode(b, fv, path+"."+f.name); err != nil {
+			return err
+		}
+	}
+	b.WriteByte('e')
+	return nil
+}
+
+// isEmpty tells whether v is a zero value skipped by omitempty
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteString(strconv.Itoa(len(s)))
+	b.WriteByte(':')
+	b.WriteString(s)
+}
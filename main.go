@@ -34,7 +34,7 @@ func initApp() *cli.App {
 	nApp.Flags = []cli.Flag{
 		cli.StringFlag{
 			Name:        "endpoint",
-			Usage:       "rTorrent endpoint",
+			Usage:       "rTorrent endpoint, http(s)://host/RPC2 or scgi://host:port or scgi:///path/to.sock",
 			Value:       "http://myrtorrent/RPC2",
 			Destination: &endpoint,
 		},
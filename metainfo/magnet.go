@@ -0,0 +1,93 @@
+package metainfo
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Magnet is the content of a magnet URI, see BEP 9 and BEP 52
+type Magnet struct {
+	// InfoHash is the v1 info-hash (xt=urn:btih:) in upper case hex as rTorrent reports it, empty if there is none
+	InfoHash string
+	// InfoHashV2 is the v2 info-hash (xt=urn:btmh:) in upper case hex, empty if there is none
+	InfoHashV2 string
+	// DisplayName is the suggested name of the torrent (dn), until its metadata is known
+	DisplayName string
+	// Trackers are the URLs of the trackers (tr)
+	Trackers []string
+	// Length is the total length of the files in bytes (xl), zero if unknown
+	Length int64
+	// WebSeeds are the URLs of web seeds (ws)
+	WebSeeds []string
+}
+
+// sha256Multihash is the multihash prefix of the SHA-256 hashes of urn:btmh
+const sha256Multihash = "1220"
+
+// ParseMagnet parses a magnet URI, which needs at least a v1 or v2 info-hash:
+//  magnet:?xt=urn:btih:C9E15763F722F23E98A29DECDFAE341B98D53056&dn=Some.Linux.Distribution&tr=udp%3A%2F%2Ftracker.example.org%3A80
+// The v1 info-hash may be hex or base32 encoded.
+func ParseMagnet(uri string) (*Magnet, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid magnet URI")
+	}
+	if !strings.EqualFold(u.Scheme, "magnet") {
+		return nil, errors.Errorf("invalid magnet URI: scheme %q", u.Scheme)
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid magnet URI")
+	}
+
+	m := &Magnet{
+		DisplayName: query.Get("dn"),
+		Trackers:    query["tr"],
+		WebSeeds:    query["ws"],
+	}
+	for _, xt := range query["xt"] {
+		lower := strings.ToLower(xt)
+		switch {
+		case strings.HasPrefix(lower, "urn:btih:"):
+			if m.InfoHash, err = parseBTIH(xt[len("urn:btih:"):]); err != nil {
+				return nil, errors.Wrap(err, "invalid magnet URI")
+			}
+		case strings.HasPrefix(lower, "urn:btmh:"):
+			hash := lower[len("urn:btmh:"):]
+			b, err := hex.DecodeString(hash)
+			if err != nil || !strings.HasPrefix(hash, sha256Multihash) || len(b) != 2+32 {
+				return nil, errors.Errorf("invalid magnet URI: invalid v2 info-hash %q", hash)
+			}
+			m.InfoHashV2 = strings.ToUpper(hash[len(sha256Multihash):])
+		}
+	}
+	if m.InfoHash == "" && m.InfoHashV2 == "" {
+		return nil, errors.New("invalid magnet URI: no info-hash")
+	}
+	if xl := query.Get("xl"); xl != "" {
+		if m.Length, err = strconv.ParseInt(xl, 10, 64); err != nil || m.Length < 0 {
+			return nil, errors.Errorf("invalid magnet URI: invalid length %q", xl)
+		}
+	}
+	return m, nil
+}
+
+// parseBTIH returns a v1 info-hash given in hex or base32 in upper case hex
+func parseBTIH(hash string) (string, error) {
+	switch len(hash) {
+	case 40:
+		if _, err := hex.DecodeString(hash); err == nil {
+			return strings.ToUpper(hash), nil
+		}
+	case 32:
+		if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash)); err == nil {
+			return strings.ToUpper(hex.EncodeToString(b)), nil
+		}
+	}
+	return "", errors.Errorf("invalid info-hash %q", hash)
+}
@@ -0,0 +1,51 @@
+package metainfo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMagnet(t *testing.T) {
+	for uri, want := range map[string]*Magnet{
+		"magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056": {
+			InfoHash: "C9E15763F722F23E98A29DECDFAE341B98D53056",
+		},
+		"magnet:?xt=urn:btih:ZHQVOY7XELZD5GFCTXWN7LRUDOMNKMCW&dn=Some+Linux%20Distribution&xl=1437206706" +
+			"&tr=udp%3A%2F%2Ftracker.example.org%3A80&tr=http%3A%2F%2Ftracker.example.org%2Fannounce&ws=https%3A%2F%2Fexample.org%2Ffiles%2F": {
+			InfoHash:    "C9E15763F722F23E98A29DECDFAE341B98D53056",
+			DisplayName: "Some Linux Distribution",
+			Trackers:    []string{"udp://tracker.example.org:80", "http://tracker.example.org/announce"},
+			Length:      1437206706,
+			WebSeeds:    []string{"https://example.org/files/"},
+		},
+		"magnet:?xt=urn:btmh:1220caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e&dn=v2": {
+			InfoHashV2:  "CAF1E1C30E81CB361B9EE167C4AA64228A7FA4FA9F6105232B28AD099F3A302E",
+			DisplayName: "v2",
+		},
+		"MAGNET:?xt=urn:btih:631a31dd0a46257d5078c0dee4e66e26f73e42ac&xt=urn:btmh:1220d8dd32ac93357c368556af3ac1d95c9d76bd0dff6fa9833ecdac3d53134efabb": {
+			InfoHash:   "631A31DD0A46257D5078C0DEE4E66E26F73E42AC",
+			InfoHashV2: "D8DD32AC93357C368556AF3AC1D95C9D76BD0DFF6FA9833ECDAC3D53134EFABB",
+		},
+	} {
+		m, err := ParseMagnet(uri)
+		require.NoError(t, err, uri)
+		require.Equal(t, want, m, uri)
+	}
+
+	for _, uri := range []string{
+		"",
+		"http://example.com/?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056",
+		"magnet:?dn=no-hash",
+		"magnet:?xt=urn:sha1:c9e15763f722f23e98a29decdfae341b98d53056",
+		"magnet:?xt=urn:btih:not-a-hash",
+		"magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d5305",
+		"magnet:?xt=urn:btmh:1114caf1e1c30e81cb361b9ee167c4aa64228a7f",
+		"magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056&xl=-1",
+		"magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056&xl=big",
+		"magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056&dn=%zz",
+	} {
+		_, err := ParseMagnet(uri)
+		require.Error(t, err, uri)
+	}
+}
@@ -0,0 +1,291 @@
+// Package metainfo parses .torrent files and magnet URIs, see BEP 3, BEP 9 and BEP 52 for BitTorrent v2.
+//
+// Parsing a file before uploading it to rTorrent validates it and gives its info-hash:
+//  mi, err := metainfo.Parse(data)
+//  ...
+//  fmt.Println(mi.Name, mi.InfoHash)
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrobinsn/go-rtorrent/bencode"
+	"github.com/pkg/errors"
+)
+
+// MetaInfo is the content of a .torrent file
+type MetaInfo struct {
+	// Name is the suggested name of the file, or of the directory of a multi-file torrent
+	Name string
+	// Files are the files of the torrent in order, a single-file torrent has one file named Name
+	Files []File
+	// MultiFile tells whether the files are stored in a directory named Name
+	MultiFile bool
+	// Length is the total length of the files in bytes, including padding files
+	Length int64
+	// PieceLength is the number of bytes in each piece
+	PieceLength int64
+	// Pieces is the number of v1 pieces, zero for v2-only torrents
+	Pieces int
+	// Private tells whether peers may only be obtained from the trackers, see BEP 27
+	Private bool
+
+	// Announce is the URL of the tracker
+	Announce string
+	// AnnounceList are the tiers of tracker URLs, see BEP 12
+	AnnounceList [][]string
+	// URLList are the URLs of web seeds, see BEP 19
+	URLList []string
+	// Comment is a free form comment of the author
+	Comment string
+	// CreatedBy is the name of the program which created the file
+	CreatedBy string
+	// CreationDate is the time the file was created, the zero time if unknown
+	CreationDate time.Time
+
+	// MetaVersion is the version of the torrent, 2 for v2 and hybrid torrents and 1 otherwise
+	MetaVersion int
+	// InfoHash is the v1 info-hash in upper case hex as rTorrent reports it, empty for v2-only torrents
+	InfoHash string
+	// InfoHashV2 is the v2 info-hash in upper case hex, empty for v1 torrents
+	InfoHashV2 string
+}
+
+// File is a file of a torrent
+type File struct {
+	// Path is the path of the file within the directory of the torrent, separated by slashes
+	Path string
+	// Length is the length of the file in bytes
+	Length int64
+	// Padding tells whether the file only aligns the next file to a piece boundary, see BEP 47
+	Padding bool
+}
+
+// Read parses the .torrent file read from r
+func Read(r io.Reader) (*MetaInfo, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read torrent")
+	}
+	return Parse(data)
+}
+
+// Parse parses the content of a .torrent file.
+// It fails for files which rTorrent and other clients would reject, e.g. without pieces or with file paths
+// escaping the directory of the torrent.
+func Parse(data []byte) (*MetaInfo, error) {
+	v, err := bencode.Decode(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid torrent")
+	}
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid torrent: not a dictionary")
+	}
+	info, ok := meta["info"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid torrent: no info dictionary")
+	}
+	rawInfo, err := bencode.RawValue(data, "info")
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid torrent")
+	}
+
+	mi := &MetaInfo{MetaVersion: 1}
+	mi.Announce, _ = meta["announce"].(string)
+	mi.Comment, _ = meta["comment"].(string)
+	mi.CreatedBy, _ = meta["created by"].(string)
+	if date, ok := meta["creation date"].(int64); ok {
+		mi.CreationDate = time.Unix(date, 0)
+	}
+	if tiers, ok := meta["announce-list"].([]interface{}); ok {
+		for _, tier := range tiers {
+			if urls := stringList(tier); len(urls) > 0 {
+				mi.AnnounceList = append(mi.AnnounceList, urls)
+			}
+		}
+	}
+	switch urls := meta["url-list"].(type) {
+	case string:
+		mi.URLList = []string{urls}
+	case []interface{}:
+		mi.URLList = stringList(urls)
+	}
+
+	if err := mi.parseInfo(info); err != nil {
+		return nil, errors.Wrap(err, "invalid torrent")
+	}
+	if mi.Pieces > 0 {
+		sum := sha1.Sum(rawInfo)
+		mi.InfoHash = strings.ToUpper(hex.EncodeToString(sum[:]))
+	}
+	if mi.MetaVersion == 2 {
+		sum := sha256.Sum256(rawInfo)
+		mi.InfoHashV2 = strings.ToUpper(hex.EncodeToString(sum[:]))
+	}
+	return mi, nil
+}
+
+func (mi *MetaInfo) parseInfo(info map[string]interface{}) error {
+	var ok bool
+	if mi.Name, ok = info["name"].(string); !ok || mi.Name == "" {
+		return errors.New("no name")
+	}
+	if err := checkPathElement(mi.Name); err != nil {
+		return errors.Wrap(err, "invalid name")
+	}
+	if mi.PieceLength, ok = info["piece length"].(int64); !ok || mi.PieceLength <= 0 {
+		return errors.New("no piece length")
+	}
+	mi.Private = info["private"] == int64(1)
+	if version, ok := info["meta version"].(int64); ok {
+		if version != 2 {
+			return errors.Errorf("unsupported meta version %d", version)
+		}
+		mi.MetaVersion = 2
+	}
+
+	pieces, hasPieces := info["pieces"].(string)
+	if hasPieces {
+		if len(pieces) == 0 || len(pieces)%sha1.Size != 0 {
+			return errors.Errorf("pieces of invalid length %d", len(pieces))
+		}
+		mi.Pieces = len(pieces) / sha1.Size
+	} else if mi.MetaVersion != 2 {
+		return errors.New("no pieces")
+	}
+
+	switch {
+	case hasPieces && info["files"] != nil:
+		if err := mi.parseFiles(info["files"]); err != nil {
+			return err
+		}
+	case hasPieces:
+		length, ok := info["length"].(int64)
+		if !ok || length < 0 {
+			return errors.New("no length")
+		}
+		mi.Files = []File{{Path: mi.Name, Length: length}}
+	default:
+		tree, ok := info["file tree"].(map[string]interface{})
+		if !ok {
+			return errors.New("no file tree")
+		}
+		if err := mi.parseFileTree(tree, ""); err != nil {
+			return err
+		}
+		// a v2 torrent of a single file is a tree holding just that file, under the name of the torrent
+		mi.MultiFile = len(mi.Files) != 1 || mi.Files[0].Path != mi.Name
+	}
+	if len(mi.Files) == 0 {
+		return errors.New("no files")
+	}
+	for _, f := range mi.Files {
+		mi.Length += f.Length
+	}
+	if hasPieces && (mi.Length+mi.PieceLength-1)/mi.PieceLength != int64(mi.Pieces) {
+		return errors.Errorf("%d pieces of %d bytes don't match a length of %d bytes", mi.Pieces, mi.PieceLength, mi.Length)
+	}
+	return nil
+}
+
+// parseFiles parses the files list of a v1 multi-file torrent
+func (mi *MetaInfo) parseFiles(v interface{}) error {
+	files, ok := v.([]interface{})
+	if !ok {
+		return errors.New("files is not a list")
+	}
+	mi.MultiFile = true
+	for i, f := range files {
+		fm, ok := f.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("file %d is not a dictionary", i)
+		}
+		length, ok := fm["length"].(int64)
+		if !ok || length < 0 {
+			return errors.Errorf("file %d has no length", i)
+		}
+		parts, ok := fm["path"].([]interface{})
+		if !ok || len(parts) == 0 {
+			return errors.Errorf("file %d has no path", i)
+		}
+		path := stringList(parts)
+		if len(path) != len(parts) {
+			return errors.Errorf("file %d has an invalid path", i)
+		}
+		for _, part := range path {
+			if err := checkPathElement(part); err != nil {
+				return errors.Wrapf(err, "file %d has an invalid path", i)
+			}
+		}
+		attr, _ := fm["attr"].(string)
+		mi.Files = append(mi.Files, File{
+			Path:    strings.Join(path, "/"),
+			Length:  length,
+			Padding: strings.Contains(attr, "p"),
+		})
+	}
+	return nil
+}
+
+// parseFileTree parses the file tree of a v2 torrent, in which a file is a dictionary with an empty key
+func (mi *MetaInfo) parseFileTree(tree map[string]interface{}, dir string) error {
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	// files are ordered by their path, as bencoded dictionaries are
+	sort.Strings(names)
+	for _, name := range names {
+		if err := checkPathElement(name); err != nil {
+			return errors.Wrapf(err, "invalid path in file tree at %q", dir)
+		}
+		path := name
+		if dir != "" {
+			path = dir + "/" + name
+		}
+		node, ok := tree[name].(map[string]interface{})
+		if !ok {
+			return errors.Errorf("invalid file tree at %q", path)
+		}
+		if file, ok := node[""].(map[string]interface{}); ok {
+			length, ok := file["length"].(int64)
+			if !ok || length < 0 {
+				return errors.Errorf("file %q has no length", path)
+			}
+			mi.Files = append(mi.Files, File{Path: path, Length: length})
+			continue
+		}
+		if err := mi.parseFileTree(node, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPathElement rejects file names which would escape the directory of the torrent
+func checkPathElement(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return errors.Errorf("unsafe file name %q", name)
+	}
+	return nil
+}
+
+// stringList returns the strings of a bencoded list, skipping other values
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	var out []string
+	for _, elem := range list {
+		if s, ok := elem.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
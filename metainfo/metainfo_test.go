@@ -0,0 +1,195 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrobinsn/go-rtorrent/bencode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFedora(t *testing.T) {
+	data, err := ioutil.ReadFile("../rtorrent/testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	mi, err := Read(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	require.Equal(t, "Fedora-i3-Live-x86_64-35", mi.Name)
+	require.True(t, mi.MultiFile)
+	require.Equal(t, []File{
+		{Path: "Fedora-Spins-35-1.2-x86_64-CHECKSUM", Length: 2226},
+		{Path: "Fedora-i3-Live-x86_64-35-1.2.iso", Length: 1437204480},
+	}, mi.Files)
+	require.Equal(t, int64(1437206706), mi.Length)
+	require.Equal(t, int64(262144), mi.PieceLength)
+	require.Equal(t, 5483, mi.Pieces)
+	require.False(t, mi.Private)
+	require.Equal(t, "http://torrent.fedoraproject.org:6969/announce", mi.Announce)
+	require.Equal(t, time.Date(2021, 11, 1, 15, 38, 26, 0, time.UTC), mi.CreationDate.UTC())
+	require.Equal(t, 1, mi.MetaVersion)
+	// as reported by rTorrent
+	require.Equal(t, "299939CFF841ED7FFCA2B3C2A35711C12589632B", mi.InfoHash)
+	require.Empty(t, mi.InfoHashV2)
+}
+
+// torrent returns a .torrent file with info, and the hex v1 and v2 hashes of info
+func torrent(t *testing.T, meta map[string]interface{}, info map[string]interface{}) (data []byte, v1, v2 string) {
+	rawInfo, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	meta["info"] = bencode.RawMessage(rawInfo)
+	data, err = bencode.Marshal(meta)
+	require.NoError(t, err)
+	sum1, sum2 := sha1.Sum(rawInfo), sha256.Sum256(rawInfo)
+	return data, strings.ToUpper(hex.EncodeToString(sum1[:])), strings.ToUpper(hex.EncodeToString(sum2[:]))
+}
+
+func TestParse(t *testing.T) {
+	t.Run("single file", func(t *testing.T) {
+		data, v1, _ := torrent(t, map[string]interface{}{
+			"announce":      "udp://tracker.example.org:80",
+			"announce-list": []interface{}{[]interface{}{"udp://tracker.example.org:80", "http://tracker.example.org/announce"}, []interface{}{}, []interface{}{"udp://backup.example.org:80"}},
+			"url-list":      "https://example.org/files/",
+			"comment":       "test",
+			"created by":    "mktorrent 1.1",
+		}, map[string]interface{}{
+			"name":         "file.iso",
+			"length":       40000,
+			"piece length": 16384,
+			"pieces":       strings.Repeat("x", 3*20),
+			"private":      1,
+		})
+		mi, err := Parse(data)
+		require.NoError(t, err)
+		require.Equal(t, &MetaInfo{
+			Name:         "file.iso",
+			Files:        []File{{Path: "file.iso", Length: 40000}},
+			Length:       40000,
+			PieceLength:  16384,
+			Pieces:       3,
+			Private:      true,
+			Announce:     "udp://tracker.example.org:80",
+			AnnounceList: [][]string{{"udp://tracker.example.org:80", "http://tracker.example.org/announce"}, {"udp://backup.example.org:80"}},
+			URLList:      []string{"https://example.org/files/"},
+			Comment:      "test",
+			CreatedBy:    "mktorrent 1.1",
+			MetaVersion:  1,
+			InfoHash:     v1,
+		}, mi)
+	})
+
+	// a v2 file tree with the pieces layers omitted
+	fileTree := map[string]interface{}{
+		"dir": map[string]interface{}{
+			"b.txt": map[string]interface{}{"": map[string]interface{}{"length": 10}},
+			"a.txt": map[string]interface{}{"": map[string]interface{}{"length": 20}},
+		},
+		"readme": map[string]interface{}{"": map[string]interface{}{"length": 30}},
+	}
+
+	t.Run("hybrid", func(t *testing.T) {
+		data, v1, v2 := torrent(t, map[string]interface{}{}, map[string]interface{}{
+			"name":         "hybrid",
+			"meta version": 2,
+			"piece length": 16384,
+			"pieces":       strings.Repeat("x", 2*20),
+			"file tree":    fileTree,
+			"files": []interface{}{
+				map[string]interface{}{"length": 20, "path": []interface{}{"dir", "a.txt"}},
+				map[string]interface{}{"length": 16364, "path": []interface{}{".pad", "16364"}, "attr": "p"},
+				map[string]interface{}{"length": 10, "path": []interface{}{"dir", "b.txt"}},
+			},
+		})
+		mi, err := Parse(data)
+		require.NoError(t, err)
+		require.Equal(t, 2, mi.MetaVersion)
+		require.Equal(t, v1, mi.InfoHash)
+		require.Equal(t, v2, mi.InfoHashV2)
+		require.True(t, mi.MultiFile)
+		require.Equal(t, []File{
+			{Path: "dir/a.txt", Length: 20},
+			{Path: ".pad/16364", Length: 16364, Padding: true},
+			{Path: "dir/b.txt", Length: 10},
+		}, mi.Files)
+		require.Equal(t, int64(16394), mi.Length)
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		data, _, v2 := torrent(t, map[string]interface{}{}, map[string]interface{}{
+			"name":         "v2",
+			"meta version": 2,
+			"piece length": 16384,
+			"file tree":    fileTree,
+		})
+		mi, err := Parse(data)
+		require.NoError(t, err)
+		require.Empty(t, mi.InfoHash)
+		require.Equal(t, v2, mi.InfoHashV2)
+		require.Zero(t, mi.Pieces)
+		require.True(t, mi.MultiFile)
+		require.Equal(t, []File{
+			{Path: "dir/a.txt", Length: 20},
+			{Path: "dir/b.txt", Length: 10},
+			{Path: "readme", Length: 30},
+		}, mi.Files)
+
+		data, _, _ = torrent(t, map[string]interface{}{}, map[string]interface{}{
+			"name":         "single.txt",
+			"meta version": 2,
+			"piece length": 16384,
+			"file tree":    map[string]interface{}{"single.txt": map[string]interface{}{"": map[string]interface{}{"length": 5}}},
+		})
+		mi, err = Parse(data)
+		require.NoError(t, err)
+		require.False(t, mi.MultiFile)
+		require.Equal(t, []File{{Path: "single.txt", Length: 5}}, mi.Files)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		valid := func() map[string]interface{} {
+			return map[string]interface{}{
+				"name":         "file.iso",
+				"length":       40000,
+				"piece length": 16384,
+				"pieces":       strings.Repeat("x", 3*20),
+			}
+		}
+		for name, change := range map[string]func(info map[string]interface{}){
+			"no name":              func(info map[string]interface{}) { delete(info, "name") },
+			"name escaping":        func(info map[string]interface{}) { info["name"] = ".." },
+			"no piece length":      func(info map[string]interface{}) { delete(info, "piece length") },
+			"no pieces":            func(info map[string]interface{}) { delete(info, "pieces") },
+			"short pieces":         func(info map[string]interface{}) { info["pieces"] = "x" },
+			"pieces mismatch":      func(info map[string]interface{}) { info["length"] = 100000 },
+			"no length":            func(info map[string]interface{}) { delete(info, "length") },
+			"negative length":      func(info map[string]interface{}) { info["length"] = -1 },
+			"unknown meta version": func(info map[string]interface{}) { info["meta version"] = 3 },
+			"path traversal": func(info map[string]interface{}) {
+				info["files"] = []interface{}{map[string]interface{}{"length": 40000, "path": []interface{}{"..", "etc", "passwd"}}}
+			},
+			"path separator": func(info map[string]interface{}) {
+				info["files"] = []interface{}{map[string]interface{}{"length": 40000, "path": []interface{}{"a/../../b"}}}
+			},
+			"empty path": func(info map[string]interface{}) {
+				info["files"] = []interface{}{map[string]interface{}{"length": 40000, "path": []interface{}{}}}
+			},
+			"no files": func(info map[string]interface{}) { info["files"] = []interface{}{} },
+		} {
+			info := valid()
+			change(info)
+			data, _, _ := torrent(t, map[string]interface{}{}, info)
+			_, err := Parse(data)
+			require.Error(t, err, name)
+		}
+
+		for _, data := range []string{"", "i1e", "de", "d4:infoi1ee", "d4:infod4:name", "d4:info9223372036854775807:xe"} {
+			_, err := Parse([]byte(data))
+			require.Error(t, err, data)
+		}
+	})
+}
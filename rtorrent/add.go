@@ -0,0 +1,165 @@
+package rtorrent
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mrobinsn/go-rtorrent/metainfo"
+	"github.com/pkg/errors"
+)
+
+// pollInterval is the interval at which AddWithOptions and WaitForMetadata poll rTorrent
+const pollInterval = 100 * time.Millisecond
+
+// AddOptions describes a torrent to add with AddWithOptions and how to set it up
+type AddOptions struct {
+	// URL is the URL of a .torrent file or a magnet URI, it is ignored if Data is set
+	URL string
+	// Data is the content of a .torrent file
+	Data []byte
+
+	// Stopped adds the torrent without starting it
+	Stopped bool
+	// Label sets the label of the torrent, i.e. d.custom1
+	Label string
+	// Directory sets the download directory, i.e. d.directory.set.
+	// The name of multi-file torrents is appended to it, use SetDirectoryBase in Commands to avoid that.
+	Directory string
+	// Priority sets the download priority. The zero value PriorityOff leaves the default priority,
+	// use SetPriority(PriorityOff) in Commands to add a torrent which isn't downloaded.
+	Priority Priority
+	// Custom sets custom values by key, i.e. d.custom.set
+	Custom map[string]string
+	// ThrottleGroup assigns the torrent to a throttle group defined in rTorrent's configuration, i.e. d.throttle_name.set
+	ThrottleGroup string
+	// Verify checks the hash of the data already on disk once the torrent is loaded, i.e. d.check_hash
+	Verify bool
+	// Commands are further commands run once the torrent is loaded, after those of the other options
+	Commands []Command
+
+	// Wait, if positive, is how long to wait for rTorrent to report the torrent loaded.
+	// rTorrent loads URLs asynchronously and drops those it can't load silently, the error of AddWithOptions
+	// then wraps ErrTorrentNotFound. If the context ends first, its error is returned instead.
+	// Waiting requires the info-hash, which is only known for Data and magnet URIs.
+	// For magnet URIs this waits for the item fetching the metadata, see WaitForMetadata for the torrent itself.
+	Wait time.Duration
+}
+
+// commands returns the commands setting up the torrent as described by the options
+func (o AddOptions) commands() []Command {
+	var commands []Command
+	if o.Directory != "" {
+		commands = append(commands, command{"d.directory.set", []string{o.Directory}})
+	}
+	if o.Label != "" {
+		commands = append(commands, DLabel.SetValue(o.Label))
+	}
+	if o.Priority != PriorityOff {
+		commands = append(commands, SetPriority(o.Priority))
+	}
+	keys := make([]string, 0, len(o.Custom))
+	for key := range o.Custom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		commands = append(commands, SetCustom(key, o.Custom[key]))
+	}
+	if o.ThrottleGroup != "" {
+		commands = append(commands, command{"d.throttle_name.set", []string{o.ThrottleGroup}})
+	}
+	commands = append(commands, o.Commands...)
+	if o.Verify {
+		commands = append(commands, command{"d.check_hash", nil})
+	}
+	return commands
+}
+
+// AddWithOptions adds a torrent as described by opts and returns it.
+//
+// The info-hash is computed locally for .torrent data and read from magnet URIs, the Hash of the returned Torrent
+// is empty for other URLs. Unless opts.Wait is set only the Hash of the Torrent is filled in.
+//  torrent, err := AddWithOptions(AddOptions{Data: fileData, Label: "my-label", Stopped: true, Wait: 10 * time.Second})
+func (r *RTorrent) AddWithOptions(opts AddOptions) (Torrent, error) {
+	return r.AddWithOptionsContext(context.Background(), opts)
+}
+
+// AddWithOptionsContext is like AddWithOptions but takes a context which controls cancellation and deadlines
+func (r *RTorrent) AddWithOptionsContext(ctx context.Context, opts AddOptions) (Torrent, error) {
+	var method, hash string
+	var data []byte
+	switch {
+	case opts.Data != nil:
+		method, data = "load.raw_start", opts.Data
+		if opts.Stopped {
+			method = "load.raw"
+		}
+		var err error
+		if hash, err = infoHash(opts.Data); err != nil {
+			return Torrent{}, errors.Wrap(err, "invalid torrent data")
+		}
+	case opts.URL != "":
+		method, data = "load.start", []byte(opts.URL)
+		if opts.Stopped {
+			method = "load.normal"
+		}
+		if strings.HasPrefix(strings.ToLower(opts.URL), "magnet:") {
+			magnet, err := metainfo.ParseMagnet(opts.URL)
+			if err != nil {
+				return Torrent{}, err
+			}
+			hash = magnet.InfoHash
+		}
+		if hash == "" && opts.Wait > 0 {
+			return Torrent{}, errors.Errorf("can't wait for %s to load, its info-hash is unknown", opts.URL)
+		}
+	default:
+		return Torrent{}, errors.New("AddOptions needs a URL or Data")
+	}
+
+	if err := r.add(ctx, method, data, opts.commands()...); err != nil {
+		return Torrent{}, err
+	}
+	if opts.Wait <= 0 {
+		return Torrent{Hash: hash}, nil
+	}
+	return r.waitLoaded(ctx, hash, opts.Wait)
+}
+
+// waitLoaded polls rTorrent until it reports the torrent with hash, for at most timeout.
+// The error wraps ErrTorrentNotFound if rTorrent did not load the torrent in time, and the error of ctx if it ended first.
+func (r *RTorrent) waitLoaded(ctx context.Context, hash string, timeout time.Duration) (Torrent, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		t, err := r.GetTorrentContext(waitCtx, hash)
+		if err == nil || !errors.Is(err, ErrTorrentNotFound) && waitCtx.Err() == nil {
+			return t, err
+		}
+		select {
+		case <-ticker.C:
+			continue
+		case <-waitCtx.Done():
+		}
+		if ctx.Err() != nil {
+			return Torrent{Hash: hash}, errors.Wrapf(ctx.Err(), "stopped waiting for torrent %s to load", hash)
+		}
+		return Torrent{Hash: hash}, errors.Wrapf(ErrTorrentNotFound, "torrent %s was not loaded within %v", hash, timeout)
+	}
+}
+
+// infoHash returns the info-hash of .torrent data as rTorrent reports it, in upper case hex
+func infoHash(data []byte) (string, error) {
+	mi, err := metainfo.Parse(data)
+	if err != nil {
+		return "", err
+	}
+	if mi.InfoHash == "" {
+		return "", errors.New("v2-only torrents have no v1 info-hash, which rTorrent requires")
+	}
+	return mi.InfoHash, nil
+}
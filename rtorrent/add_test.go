@@ -0,0 +1,161 @@
+package rtorrent
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrobinsn/go-rtorrent/rtorrent/rtorrenttest"
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// loadRecorder records the params of the load.* calls made through it
+type loadRecorder struct {
+	mu    sync.Mutex
+	calls [][]interface{}
+}
+
+func (l *loadRecorder) intercept(ctx context.Context, method string, args []interface{}, next xmlrpc.Invoker) (interface{}, error) {
+	if strings.HasPrefix(method, "load.") {
+		l.mu.Lock()
+		l.calls = append(l.calls, append([]interface{}{method}, args[1].([]interface{})[1:]...))
+		l.mu.Unlock()
+	}
+	return next(ctx, method, args)
+}
+
+func (l *loadRecorder) last() []interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.calls) == 0 {
+		return nil
+	}
+	return l.calls[len(l.calls)-1]
+}
+
+func TestAddWithOptions(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	recorder := &loadRecorder{}
+	client := New(srv.URL, false, xmlrpc.WithInterceptors(recorder.intercept))
+
+	torrent, err := client.AddWithOptions(AddOptions{
+		Data:          data,
+		Stopped:       true,
+		Label:         "linux",
+		Directory:     "/downloads/new",
+		Priority:      PriorityHigh,
+		Custom:        map[string]string{"source": "rss", "added_by": "test"},
+		ThrottleGroup: "slow",
+		Verify:        true,
+		Commands:      []Command{SetCustom("extra", "1")},
+		Wait:          5 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{
+		"load.raw",
+		`d.directory.set="/downloads/new"`,
+		`d.custom1.set="linux"`,
+		`d.priority.set="3"`,
+		`d.custom.set="added_by","test"`,
+		`d.custom.set="source","rss"`,
+		`d.throttle_name.set="slow"`,
+		`d.custom.set="extra","1"`,
+		`d.check_hash=`,
+	}, recorder.last())
+
+	torrents, err := client.GetTorrents(ViewMain)
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	require.Equal(t, torrents[0], torrent)
+	require.Equal(t, "linux", torrent.Label)
+	require.True(t, strings.HasPrefix(torrent.Path, "/downloads/new"), torrent.Path)
+	active, err := client.IsActive(torrent)
+	require.NoError(t, err)
+	require.False(t, active)
+	result, err := xmlrpc.NewClient(srv.URL, false).Call("d.throttle_name", torrent.Hash)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"slow"}, result)
+
+	t.Run("started without waiting", func(t *testing.T) {
+		require.NoError(t, client.Delete(torrent))
+		added, err := client.AddWithOptions(AddOptions{Data: data})
+		require.NoError(t, err)
+		require.Equal(t, Torrent{Hash: torrent.Hash}, added)
+		require.Equal(t, []interface{}{"load.raw_start"}, recorder.last())
+		active, err := client.IsActive(added)
+		require.NoError(t, err)
+		require.True(t, active)
+	})
+
+	t.Run("url", func(t *testing.T) {
+		srv.AddURL("http://example.com/fedora.torrent", data)
+		added, err := client.AddWithOptions(AddOptions{URL: "http://example.com/fedora.torrent", Stopped: true})
+		require.NoError(t, err)
+		// rTorrent fetches the URL, so its info-hash is unknown
+		require.Empty(t, added.Hash)
+		require.Equal(t, []interface{}{"load.normal"}, recorder.last())
+
+		calls := len(recorder.calls)
+		_, err = client.AddWithOptions(AddOptions{URL: "http://example.com/fedora.torrent", Wait: time.Second})
+		require.Error(t, err)
+		require.Len(t, recorder.calls, calls)
+	})
+
+	t.Run("magnet", func(t *testing.T) {
+		magnet := "magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056&dn=Some.Linux.Distribution"
+		added, err := client.AddWithOptions(AddOptions{URL: magnet, Label: "magnet"})
+		require.NoError(t, err)
+		require.Equal(t, "C9E15763F722F23E98A29DECDFAE341B98D53056", added.Hash)
+		require.Equal(t, []interface{}{"load.start", `d.custom1.set="magnet"`}, recorder.last())
+
+		// the item fetching the metadata is loaded right away
+		added, err = client.AddWithOptions(AddOptions{URL: magnet, Wait: time.Second})
+		require.NoError(t, err)
+		require.Equal(t, "Some.Linux.Distribution", added.Name)
+
+		// rTorrent drops URLs it can't load silently
+		dropping := New(srv.URL, false, xmlrpc.WithInterceptors(func(ctx context.Context, method string, args []interface{}, next xmlrpc.Invoker) (interface{}, error) {
+			if strings.HasPrefix(method, "load.") {
+				return 0, nil
+			}
+			return next(ctx, method, args)
+		}))
+		magnet = "magnet:?xt=urn:btih:631a31dd0a46257d5078c0dee4e66e26f73e42ac"
+		start := time.Now()
+		added, err = dropping.AddWithOptions(AddOptions{URL: magnet, Wait: 300 * time.Millisecond})
+		require.True(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+		require.Contains(t, err.Error(), "was not loaded within")
+		require.True(t, time.Since(start) >= 300*time.Millisecond)
+		require.Equal(t, "631A31DD0A46257D5078C0DEE4E66E26F73E42AC", added.Hash)
+
+		// the context ending first is told apart from rTorrent not loading the torrent
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start = time.Now()
+		added, err = dropping.AddWithOptionsContext(ctx, AddOptions{URL: magnet, Wait: 5 * time.Second})
+		require.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+		require.False(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+		require.True(t, time.Since(start) < 5*time.Second)
+		require.Equal(t, "631A31DD0A46257D5078C0DEE4E66E26F73E42AC", added.Hash)
+
+		_, err = client.AddWithOptions(AddOptions{URL: "magnet:?xt=urn:btih:invalid"})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := client.AddWithOptions(AddOptions{})
+		require.Error(t, err)
+		_, err = client.AddWithOptions(AddOptions{Data: []byte("not a torrent")})
+		require.Error(t, err)
+		_, err = client.AddWithOptions(AddOptions{Data: data, Label: "$execute=rm"})
+		require.True(t, errors.Is(err, ErrInvalidCommand), "unexpected error: %v", err)
+	})
+}
@@ -0,0 +1,111 @@
+package rtorrent
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCommand is matched by errors for commands which can't be passed to rTorrent safely,
+// e.g. with a field name containing quotes or a value which rTorrent would evaluate as a command
+var ErrInvalidCommand = errors.New("invalid command")
+
+// Command is a command rTorrent runs on a torrent right after loading it, see Add and AddStopped.
+// Commands are built with Field.SetValue, SetCustom, SetPriority and SetDirectoryBase, which escape their values.
+type Command interface {
+	// Command returns the command in rTorrent's command syntax, e.g. d.custom1.set="my label"
+	Command() (string, error)
+}
+
+// Priority is the download priority of a torrent
+type Priority int
+
+// Priorities of d.priority.set
+const (
+	PriorityOff    Priority = 0
+	PriorityLow    Priority = 1
+	PriorityNormal Priority = 2
+	PriorityHigh   Priority = 3
+)
+
+// commandNamePattern matches command names like d.custom1.set, anything else could inject further commands
+var commandNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+// command is a command with string arguments, each of them quoted
+type command struct {
+	name string
+	args []string
+}
+
+// SetCustom returns a Command setting the custom value of a torrent for key, i.e. d.custom.set
+//  SetCustom("tracker", "example.org")
+func SetCustom(key, value string) Command {
+	return command{"d.custom.set", []string{key, value}}
+}
+
+// SetPriority returns a Command setting the download priority of a torrent, i.e. d.priority.set
+func SetPriority(priority Priority) Command {
+	return command{"d.priority.set", []string{strconv.Itoa(int(priority))}}
+}
+
+// SetDirectoryBase returns a Command setting the directory of a torrent's data, i.e. d.directory_base.set.
+// Unlike d.directory.set the name of multi-file torrents is not appended to it.
+func SetDirectoryBase(dir string) Command {
+	return command{"d.directory_base.set", []string{dir}}
+}
+
+// Command implements Command
+func (c command) Command() (string, error) {
+	if !commandNamePattern.MatchString(c.name) {
+		return "", errors.Wrapf(ErrInvalidCommand, "invalid name %q", c.name)
+	}
+	quoted := make([]string, len(c.args))
+	for i, arg := range c.args {
+		// rTorrent evaluates arguments starting with $ as commands, even once unquoted,
+		// and reads its commands as C strings which end at the first NUL
+		if strings.HasPrefix(arg, "$") || strings.ContainsRune(arg, 0) {
+			return "", errors.Wrapf(ErrInvalidCommand, "unsafe argument %q of %s", arg, c.name)
+		}
+		quoted[i] = quote(arg)
+	}
+	return c.name + "=" + strings.Join(quoted, ","), nil
+}
+
+// Command implements Command, it fails for field names which aren't plain command names
+func (f *FieldValue) Command() (string, error) {
+	return command{string(f.Field) + ".set", []string{f.Value}}.Command()
+}
+
+// quote returns s as a double quoted string of rTorrent's command syntax, in which commas and semicolons
+// are literal and double quotes and backslashes are escaped with a backslash
+func quote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// commandArgs returns the commands as arguments of a load.* call
+func commandArgs(commands []Command) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(commands))
+	for _, c := range commands {
+		if c == nil {
+			continue
+		}
+		cmd, err := c.Command()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, cmd)
+	}
+	return args, nil
+}
@@ -0,0 +1,83 @@
+package rtorrent
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/mrobinsn/go-rtorrent/rtorrent/rtorrenttest"
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand(t *testing.T) {
+	for _, tc := range []struct {
+		cmd  Command
+		want string
+	}{
+		{DLabel.SetValue("my-label"), `d.custom1.set="my-label"`},
+		{DLabel.SetValue(""), `d.custom1.set=""`},
+		{DLabel.SetValue(`say "hi"`), `d.custom1.set="say \"hi\""`},
+		{DLabel.SetValue(`a,b;c`), `d.custom1.set="a,b;c"`},
+		{DLabel.SetValue(`C:\downloads\`), `d.custom1.set="C:\\downloads\\"`},
+		{DLabel.SetValue(`x";execute=rm,-rf,/;d.custom1.set="`), `d.custom1.set="x\";execute=rm,-rf,/;d.custom1.set=\""`},
+		{DLabel.SetValue("a\nb"), "d.custom1.set=\"a\nb\""},
+		{DLabel.SetValue("a$b"), `d.custom1.set="a$b"`},
+		{SetCustom("source", "rss, \"feed\""), `d.custom.set="source","rss, \"feed\""`},
+		{SetPriority(PriorityHigh), `d.priority.set="3"`},
+		{SetDirectoryBase("/downloads/my dir"), `d.directory_base.set="/downloads/my dir"`},
+	} {
+		cmd, err := tc.cmd.Command()
+		require.NoError(t, err)
+		require.Equal(t, tc.want, cmd)
+	}
+	require.Equal(t, `d.custom1.set="say \"hi\""`, DLabel.SetValue(`say "hi"`).String())
+
+	for _, cmd := range []Command{
+		&FieldValue{`d.custom1.set="x";execute=rm`, "label"},
+		&FieldValue{"d.custom1=", "label"},
+		&FieldValue{"d custom1", "label"},
+		&FieldValue{"", "label"},
+		&FieldValue{"d..custom1", "label"},
+		DLabel.SetValue("$execute=rm,-rf,/"),
+		DLabel.SetValue("label\x00execute=rm"),
+		SetCustom("$cat=", "value"),
+	} {
+		_, err := cmd.Command()
+		require.True(t, errors.Is(err, ErrInvalidCommand), "unexpected error for %v: %v", cmd, err)
+	}
+}
+
+func TestAddCommands(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	client := New(srv.URL, false)
+
+	// invalid commands fail before anything is loaded
+	err = client.AddTorrentStopped(data, DLabel.SetValue("label"), &FieldValue{`d.custom1.set="x";d.erase`, ""})
+	require.True(t, errors.Is(err, ErrInvalidCommand), "unexpected error: %v", err)
+	torrents, err := client.GetTorrents(ViewMain)
+	require.NoError(t, err)
+	require.Empty(t, torrents)
+
+	label := `my "label", with; d.erase="all`
+	require.NoError(t, client.AddTorrentStopped(data,
+		DLabel.SetValue(label),
+		SetCustom("source", `C:\feeds\"rss"`),
+		SetPriority(PriorityLow),
+		SetDirectoryBase("/downloads/a,b"),
+	))
+	torrents, err = client.GetTorrents(ViewMain)
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	require.Equal(t, label, torrents[0].Label)
+	require.Equal(t, "/downloads/a,b", torrents[0].Path)
+
+	var priority []int
+	result, err := xmlrpc.NewClient(srv.URL, false).Call("d.priority", torrents[0].Hash)
+	require.NoError(t, err)
+	require.NoError(t, xmlrpc.Decode(result, &priority))
+	require.Equal(t, []int{int(PriorityLow)}, priority)
+}
@@ -0,0 +1,74 @@
+package rtorrent
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IsMeta checks if the torrent was added from a magnet URI and only fetches the metadata of the actual torrent
+func (r *RTorrent) IsMeta(t Torrent) (bool, error) {
+	return r.IsMetaContext(context.Background(), t)
+}
+
+// IsMetaContext is like IsMeta but takes a context which controls cancellation and deadlines
+func (r *RTorrent) IsMetaContext(ctx context.Context, t Torrent) (bool, error) {
+	var meta int
+	if err := r.call(ctx, &meta, string(DIsMeta), t.Hash); err != nil {
+		return false, err
+	}
+	return meta == 1, nil
+}
+
+// missingGrace is how long WaitForMetadata tolerates the torrent missing while rTorrent replaces the meta item
+const missingGrace = 2 * time.Second
+
+// WaitForMetadata waits until the metadata of a torrent added from a magnet URI arrived and returns the torrent
+// with its name and size. rTorrent replaces the item fetching the metadata with the actual torrent under the same
+// info-hash, which may be missing for a moment. If it stays missing for longer, because it was never added or has
+// been erased, the error wraps ErrTorrentNotFound. As nobody may have the metadata, ctx should carry a deadline:
+//  ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+//  defer cancel()
+//  torrent, err := client.WaitForMetadata(ctx, added.Hash)
+func (r *RTorrent) WaitForMetadata(ctx context.Context, hash string) (Torrent, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	var missingSince time.Time
+	for {
+		t, ok, err := r.metadataArrived(ctx, hash)
+		switch {
+		case ok:
+			return t, nil
+		case errors.Is(err, ErrTorrentNotFound):
+			if missingSince.IsZero() {
+				missingSince = time.Now()
+			} else if time.Since(missingSince) >= missingGrace {
+				return Torrent{Hash: hash}, err
+			}
+		case err != nil && ctx.Err() == nil:
+			return Torrent{}, err
+		default:
+			missingSince = time.Time{}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return Torrent{Hash: hash}, errors.Wrapf(ctx.Err(), "metadata of torrent %s did not arrive", hash)
+		}
+	}
+}
+
+// metadataArrived returns the torrent with hash if it is not fetching its metadata anymore
+func (r *RTorrent) metadataArrived(ctx context.Context, hash string) (Torrent, bool, error) {
+	meta, err := r.IsMetaContext(ctx, Torrent{Hash: hash})
+	if err != nil || meta {
+		return Torrent{}, false, err
+	}
+	t, err := r.GetTorrentContext(ctx, hash)
+	if err != nil {
+		return Torrent{}, false, err
+	}
+	// the size is only known once the metadata is
+	return t, t.Size > 0, nil
+}
@@ -0,0 +1,95 @@
+package rtorrent
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mrobinsn/go-rtorrent/rtorrent/rtorrenttest"
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForMetadata(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	srv.MetadataDelay = 200 * time.Millisecond
+	client := New(srv.URL, false)
+
+	magnet := "magnet:?xt=urn:btih:299939cff841ed7ffca2b3c2a35711c12589632b&dn=Fedora+i3&tr=http%3A%2F%2Ftorrent.fedoraproject.org%3A6969%2Fannounce"
+	added, err := client.AddWithOptions(AddOptions{URL: magnet, Label: "magnet", Wait: 5 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, "299939CFF841ED7FFCA2B3C2A35711C12589632B", added.Hash)
+	require.Equal(t, "Fedora i3", added.Name)
+	require.Equal(t, "magnet", added.Label)
+	require.Zero(t, added.Size)
+	meta, err := client.IsMeta(added)
+	require.NoError(t, err)
+	require.True(t, meta)
+
+	// nobody has the metadata yet
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_, err = client.WaitForMetadata(ctx, added.Hash)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+
+	require.NoError(t, srv.AddMetadata(data))
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	torrent, err := client.WaitForMetadata(ctx, added.Hash)
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < 5*time.Second)
+	require.Equal(t, added.Hash, torrent.Hash)
+	require.Equal(t, "Fedora-i3-Live-x86_64-35", torrent.Name)
+	require.Equal(t, int64(1437206706), torrent.Size)
+	require.Equal(t, "magnet", torrent.Label)
+
+	meta, err = client.IsMeta(torrent)
+	require.NoError(t, err)
+	require.False(t, meta)
+	active, err := client.IsActive(torrent)
+	require.NoError(t, err)
+	require.True(t, active)
+	files, err := client.GetFiles(torrent)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	// a torrent which was not added from a magnet URI has its metadata already
+	torrent, err = client.WaitForMetadata(context.Background(), torrent.Hash)
+	require.NoError(t, err)
+	require.Equal(t, "Fedora-i3-Live-x86_64-35", torrent.Name)
+
+	// errors other than a missing torrent end the wait
+	_, err = fakeResponse(t, xmlrpc.Fault{Code: -503, Message: "Invalid parameters"}).WaitForMetadata(context.Background(), added.Hash)
+	var fault *xmlrpc.Fault
+	require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+}
+
+func TestWaitForMetadataMissing(t *testing.T) {
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	srv.MetadataDelay = time.Hour
+	client := New(srv.URL, false)
+
+	// the wait ends even without a deadline
+	start := time.Now()
+	_, err := client.WaitForMetadata(context.Background(), "C9E15763F722F23E98A29DECDFAE341B98D53056")
+	require.True(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+	require.True(t, time.Since(start) >= missingGrace)
+	require.True(t, time.Since(start) < missingGrace+time.Second)
+
+	added, err := client.AddWithOptions(AddOptions{URL: "magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056", Wait: time.Second})
+	require.NoError(t, err)
+	deleted := make(chan error, 1)
+	time.AfterFunc(300*time.Millisecond, func() {
+		deleted <- client.Delete(added)
+	})
+	_, err = client.WaitForMetadata(context.Background(), added.Hash)
+	require.True(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+	require.NoError(t, <-deleted)
+}
@@ -0,0 +1,211 @@
+package rtorrent
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
+	"github.com/pkg/errors"
+)
+
+// Row holds the values of the fields of one torrent returned by Query
+type Row map[Field]interface{}
+
+// Decode decodes the value of field f into target, see xmlrpc.Decode
+func (r Row) Decode(f Field, target interface{}) error {
+	v, ok := r[f]
+	if !ok {
+		return errors.Errorf("field %s was not queried", f)
+	}
+	return xmlrpc.Decode(v, target)
+}
+
+// String returns the value of field f as a string, or "" if it is missing or not a string
+func (r Row) String(f Field) string {
+	var s string
+	_ = r.Decode(f, &s)
+	return s
+}
+
+// Int returns the value of field f as an integer, or 0 if it is missing or not an integer
+func (r Row) Int(f Field) int64 {
+	var i int64
+	_ = r.Decode(f, &i)
+	return i
+}
+
+// Bool returns the value of field f as a boolean, which rTorrent reports as 0 or 1, or false if it is missing
+func (r Row) Bool(f Field) bool {
+	var b bool
+	_ = r.Decode(f, &b)
+	return b
+}
+
+// Time returns the value of field f, a Unix timestamp, as a time, or the zero time if it is missing
+func (r Row) Time(f Field) time.Time {
+	var t time.Time
+	_ = r.Decode(f, &t)
+	return t
+}
+
+// Query returns the given fields of each of the torrents in view with a single d.multicall2 call.
+// Unlike GetTorrents only the given fields are fetched, which may be any d.* command without arguments:
+//  rows, err := client.Query(rtorrent.ViewMain, rtorrent.DHash, rtorrent.DPeersConnected, rtorrent.Custom("tag"))
+//  ...
+//  fmt.Println(rows[0].String(rtorrent.DHash), rows[0].Int(rtorrent.DPeersConnected))
+func (r *RTorrent) Query(view View, fields ...Field) ([]Row, error) {
+	return r.QueryContext(context.Background(), view, fields...)
+}
+
+// QueryContext is like Query but takes a context which controls cancellation and deadlines
+func (r *RTorrent) QueryContext(ctx context.Context, view View, fields ...Field) ([]Row, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("no fields to query")
+	}
+	rows := []Row{}
+	args, err := queryArgs(view, fields)
+	if err != nil {
+		return nil, err
+	}
+	err = r.each(ctx, "d.multicall2", args, func(elem interface{}) error {
+		values, ok := elem.([]interface{})
+		if !ok || len(values) != len(fields) {
+			return &UnexpectedResponseError{Method: "d.multicall2", Value: elem, Err: errors.Errorf("expected %d values", len(fields))}
+		}
+		row := make(Row, len(fields))
+		for i, f := range fields {
+			row[f] = values[i]
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// QueryInto queries the torrents in view and appends one element per torrent to the slice pointed to by target.
+// The elements are structs, or pointers to structs, whose fields are tagged with the field to query,
+// untagged fields are left alone:
+//  var torrents []struct {
+//  	Hash    string `rtorrent:"d.hash"`
+//  	Peers   int    `rtorrent:"d.peers_connected"`
+//  	Message string `rtorrent:"d.message"`
+//  	Tag     string `rtorrent:"d.custom=\"tag\""`
+//  }
+//  err := client.QueryInto(rtorrent.ViewMain, &torrents)
+func (r *RTorrent) QueryInto(view View, target interface{}) error {
+	return r.QueryIntoContext(context.Background(), view, target)
+}
+
+// QueryIntoContext is like QueryInto but takes a context which controls cancellation and deadlines
+func (r *RTorrent) QueryIntoContext(ctx context.Context, view View, target interface{}) error {
+	slice := reflect.ValueOf(target)
+	if slice.Kind() != reflect.Ptr || slice.IsNil() || slice.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("target must be a pointer to a slice, got %T", target)
+	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	structType := elemType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return errors.Errorf("target must be a pointer to a slice of structs, got %T", target)
+	}
+
+	var fields []Field
+	var index []int
+	for i := 0; i < structType.NumField(); i++ {
+		sf := structType.Field(i)
+		tag := sf.Tag.Get("rtorrent")
+		if tag == "" || tag == "-" || sf.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, Field(tag))
+		index = append(index, i)
+	}
+	if len(fields) == 0 {
+		return errors.Errorf("%s has no fields tagged with rtorrent", structType)
+	}
+
+	args, err := queryArgs(view, fields)
+	if err != nil {
+		return err
+	}
+	return r.each(ctx, "d.multicall2", args, func(elem interface{}) error {
+		values, ok := elem.([]interface{})
+		if !ok || len(values) != len(fields) {
+			return &UnexpectedResponseError{Method: "d.multicall2", Value: elem, Err: errors.Errorf("expected %d values", len(fields))}
+		}
+		row := reflect.New(structType)
+		for i, v := range values {
+			if err := xmlrpc.Decode(v, row.Elem().Field(index[i]).Addr().Interface()); err != nil {
+				return &UnexpectedResponseError{Method: "d.multicall2", Value: elem, Err: errors.Wrapf(err, "field %s", fields[i])}
+			}
+		}
+		if elemType.Kind() != reflect.Ptr {
+			row = row.Elem()
+		}
+		slice.Set(reflect.Append(slice, row))
+		return nil
+	})
+}
+
+// queryArgs returns the params of d.multicall2 fetching fields of the torrents in view.
+// It fails with ErrInvalidCommand for fields which would make rTorrent run further commands.
+func queryArgs(view View, fields []Field) ([]interface{}, error) {
+	args := make([]interface{}, 0, len(fields)+2)
+	args = append(args, "", string(view))
+	for _, f := range fields {
+		if err := checkQuery(f); err != nil {
+			return nil, err
+		}
+		args = append(args, f.Query())
+	}
+	return args, nil
+}
+
+// checkQuery checks that f is a plain command name, optionally followed by arguments after "=",
+// none of which starts with $ or contains a NUL, see command.Command
+func checkQuery(f Field) error {
+	query := string(f)
+	name, args := query, ""
+	if i := strings.Index(query, "="); i >= 0 {
+		name, args = query[:i], query[i+1:]
+	}
+	if !commandNamePattern.MatchString(name) {
+		return errors.Wrapf(ErrInvalidCommand, "invalid name %q", name)
+	}
+	if strings.ContainsRune(args, 0) {
+		return errors.Wrapf(ErrInvalidCommand, "unsafe argument of %s", name)
+	}
+	argStart, quoted, escaped := true, false, false
+	for i := 0; i < len(args); i++ {
+		if argStart {
+			// quotes and escapes in front of the $ don't keep rTorrent from evaluating it
+			j := i
+			for j < len(args) && (args[j] == '"' || args[j] == '\\') {
+				j++
+			}
+			if j < len(args) && args[j] == '$' {
+				return errors.Wrapf(ErrInvalidCommand, "unsafe argument of %s", name)
+			}
+			argStart = false
+		}
+		switch c := args[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			argStart = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package rtorrent
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mrobinsn/go-rtorrent/rtorrent/rtorrenttest"
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	client := New(srv.URL, false)
+
+	rows, err := client.Query(ViewMain, DHash)
+	require.NoError(t, err)
+	require.Empty(t, rows)
+
+	_, err = client.AddWithOptions(AddOptions{
+		Data:     data,
+		Stopped:  true,
+		Label:    "linux",
+		Priority: PriorityHigh,
+		Custom:   map[string]string{"source": "rss", `we"ird,key\`: "escaped"},
+		Wait:     5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	t.Run("rows", func(t *testing.T) {
+		rows, err := client.Query(ViewMain, DHash, DSizeInBytes, DIsActive, DPeersConnected, DMessage, DCreationTime, Custom("source"), DLabel)
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		row := rows[0]
+		require.Equal(t, "299939CFF841ED7FFCA2B3C2A35711C12589632B", row.String(DHash))
+		require.Equal(t, int64(1437206706), row.Int(DSizeInBytes))
+		require.False(t, row.Bool(DIsActive))
+		require.Zero(t, row.Int(DPeersConnected))
+		require.Empty(t, row.String(DMessage))
+		require.Equal(t, time.Date(2021, 11, 1, 15, 38, 26, 0, time.UTC), row.Time(DCreationTime).UTC())
+		require.Equal(t, "rss", row.String(Custom("source")))
+		require.Equal(t, "linux", row.String(DLabel))
+
+		// keys are passed as a single argument, whatever they contain
+		rows, err = client.Query(ViewMain, Custom(`we"ird,key\`), Custom("key$"))
+		require.NoError(t, err)
+		require.Equal(t, "escaped", rows[0].String(Custom(`we"ird,key\`)))
+		require.Empty(t, rows[0].String(Custom("key$")))
+
+		// rTorrent evaluates arguments starting with $ even when quoted
+		for _, f := range []Field{Custom("$we"), Custom("a\x00b"), Field("d.custom=$execute=rm"), Field(`d.custom="\"$x"`),
+			Field("d.custom=a,$execute=rm"), Field("d.name;execute=rm"), Field(`d.custom="a",$x`)} {
+			_, err = client.Query(ViewMain, DHash, f)
+			require.True(t, errors.Is(err, ErrInvalidCommand), "unexpected error for %s: %v", f, err)
+		}
+
+		// mismatching and missing fields give zero values
+		require.Zero(t, row.Int(DHash))
+		require.Empty(t, row.String(DName))
+		var priority int
+		require.Error(t, row.Decode(DName, &priority))
+
+		rows, err = client.Query(ViewStarted, DHash)
+		require.NoError(t, err)
+		require.Empty(t, rows)
+	})
+
+	t.Run("into", func(t *testing.T) {
+		type status struct {
+			Hash     string    `rtorrent:"d.hash"`
+			Priority Priority  `rtorrent:"d.priority"`
+			Source   string    `rtorrent:"d.custom=\"source\""`
+			Open     bool      `rtorrent:"d.is_open"`
+			Created  time.Time `rtorrent:"d.creation_date"`
+			Note     string
+		}
+		var torrents []status
+		require.NoError(t, client.QueryInto(ViewStopped, &torrents))
+		require.Equal(t, []status{{
+			Hash:     "299939CFF841ED7FFCA2B3C2A35711C12589632B",
+			Priority: PriorityHigh,
+			Source:   "rss",
+			Open:     false,
+			Created:  time.Unix(1635781106, 0),
+		}}, torrents)
+
+		var pointers []*status
+		require.NoError(t, client.QueryInto(ViewMain, &pointers))
+		require.Len(t, pointers, 1)
+		require.Equal(t, torrents[0], *pointers[0])
+
+		require.Error(t, client.QueryInto(ViewMain, torrents))
+		require.Error(t, client.QueryInto(ViewMain, &[]string{}))
+		require.Error(t, client.QueryInto(ViewMain, &[]struct{ Hash string }{}))
+
+		var unsafe []struct {
+			Tag string `rtorrent:"d.custom=$execute=rm"`
+		}
+		err := client.QueryInto(ViewMain, &unsafe)
+		require.True(t, errors.Is(err, ErrInvalidCommand), "unexpected error: %v", err)
+		require.Empty(t, unsafe)
+
+		var mismatch []struct {
+			Size time.Duration `rtorrent:"d.name"`
+		}
+		err = client.QueryInto(ViewMain, &mismatch)
+		var unexpected *UnexpectedResponseError
+		require.True(t, errors.As(err, &unexpected), "unexpected error: %v", err)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := client.Query(ViewMain)
+		require.Error(t, err)
+
+		_, err = client.Query(ViewMain, Field("d.no_such_field"))
+		var fault *xmlrpc.Fault
+		require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+	})
+}
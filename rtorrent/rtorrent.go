@@ -1,8 +1,10 @@
 package rtorrent
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/mrobinsn/go-rtorrent/xmlrpc"
@@ -12,6 +14,7 @@ import (
 // RTorrent is used to communicate with a remote rTorrent instance
 type RTorrent struct {
 	addr         string
+	opts         []xmlrpc.Option
 	xmlrpcClient *xmlrpc.Client
 }
 
@@ -26,7 +29,7 @@ type Torrent struct {
 	Hash      string
 	Name      string
 	Path      string
-	Size      int
+	Size      int64
 	Label     string
 	Completed bool
 	Ratio     float64
@@ -38,17 +41,79 @@ type Torrent struct {
 // Status represents the status of a torrent
 type Status struct {
 	Completed      bool
-	CompletedBytes int
+	CompletedBytes int64
 	DownRate       int
 	UpRate         int
 	Ratio          float64
-	Size           int
+	Size           int64
 }
 
 // File represents a file in rTorrent
 type File struct {
 	Path string
-	Size int
+	Size int64
+}
+
+var (
+	// ErrTorrentNotFound is matched by errors for calls on an info-hash which rTorrent does not know
+	ErrTorrentNotFound = errors.New("torrent not found")
+	// ErrUnknownMethod is matched by errors for calls of a method which rTorrent does not define
+	ErrUnknownMethod = errors.New("unknown method")
+)
+
+// UnexpectedResponseError is returned when rTorrent answers a call with a value of an unexpected shape,
+// e.g. a string where an integer was expected or an empty array where a value was expected
+type UnexpectedResponseError struct {
+	// Method is the name of the XMLRPC method which was called
+	Method string
+	// Value is the raw value returned by the call
+	Value interface{}
+	// Err describes why the value was unexpected
+	Err error
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	return fmt.Sprintf("%s returned an unexpected response %v: %v", e.Method, e.Value, e.Err)
+}
+
+// Unwrap returns the underlying error, typically an *xmlrpc.DecodeError
+func (e *UnexpectedResponseError) Unwrap() error {
+	return e.Err
+}
+
+// faultError ties a fault reported by rTorrent to the sentinel error it represents, so
+// both errors.Is(err, ErrTorrentNotFound) and errors.As(err, &fault) work on the result
+type faultError struct {
+	fault    *xmlrpc.Fault
+	sentinel error
+}
+
+func (e *faultError) Error() string {
+	return e.fault.Error()
+}
+
+func (e *faultError) Unwrap() error {
+	return e.fault
+}
+
+func (e *faultError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// mapFault maps faults rTorrent reports for well known conditions onto the matching sentinel error
+func mapFault(err error) error {
+	var fault *xmlrpc.Fault
+	if !errors.As(err, &fault) {
+		return err
+	}
+	switch {
+	case strings.Contains(fault.Message, "Could not find info-hash"):
+		return &faultError{fault: fault, sentinel: ErrTorrentNotFound}
+	// -506 is used by xmlrpc-c (and so rTorrent), -32601 by the fault code interoperability specification
+	case fault.Code == -506 || fault.Code == -32601:
+		return &faultError{fault: fault, sentinel: ErrUnknownMethod}
+	}
+	return err
 }
 
 // Field represents a attribute on a RTorrent entity that can be queried or set
@@ -83,6 +148,8 @@ const (
 	DDirectory Field = "d.directory"
 	// DIsActive represents whether a "Downloading Item" is active or not
 	DIsActive Field = "d.is_active"
+	// DIsMeta represents whether a "Downloading Item" only fetches the metadata of a magnet URI
+	DIsMeta Field = "d.is_meta"
 	// DRatio represents the ratio of a "Downloading Item"
 	DRatio Field = "d.ratio"
 	// DComplete represents whether the "Downloading Item" is complete or not
@@ -99,6 +166,10 @@ const (
 	DFinishedTime Field = "d.timestamp.finished"
 	// DStartedTime represents the date the torrent started downloading
 	DStartedTime Field = "d.timestamp.started"
+	// DPeersConnected represents the number of peers the "Downloading Item" is connected to
+	DPeersConnected Field = "d.peers_connected"
+	// DMessage represents the last message of the tracker or of rTorrent about the "Downloading Item"
+	DMessage Field = "d.message"
 
 	// FPath represents the path of a "File Item"
 	FPath Field = "f.path"
@@ -109,11 +180,24 @@ const (
 // Query converts the field to a string which allows it to be queried
 // Example:
 //  DName.Query() // returns "d.name="
+// A field which already carries its argument is returned as is:
+//  Custom("tag").Query() // returns "d.custom=\"tag\""
 func (f Field) Query() string {
+	if strings.Contains(string(f), "=") {
+		return string(f)
+	}
 	return fmt.Sprintf("%s=", f)
 }
 
-// SetValue returns a FieldValue struct which can be used to set the field on a particular item in rTorrent to the specified value
+// Custom returns the field holding the custom value stored under key, which can be queried with Query and QueryInto.
+// The key is quoted, so it is always passed to rTorrent as a single argument. Like the arguments of commands,
+// keys starting with $ or containing NUL can't be passed safely, Query and QueryInto fail with ErrInvalidCommand for them.
+func Custom(key string) Field {
+	return Field("d.custom=" + quote(key))
+}
+
+// SetValue returns a FieldValue struct which can be used to set the field on a particular item in rTorrent to the specified value.
+// It is a Command which can be passed to Add and AddStopped.
 func (f Field) SetValue(value string) *FieldValue {
 	return &FieldValue{f, value}
 }
@@ -123,8 +207,10 @@ func (f Field) Cmd() string {
 	return string(f)
 }
 
+// String returns the command setting the field to the value, with the value escaped.
+// Use Command to check that the field name is safe to send to rTorrent as well.
 func (f *FieldValue) String() string {
-	return fmt.Sprintf("%s.set=\"%s\"", f.Field, f.Value)
+	return fmt.Sprintf("%s.set=%s", f.Field, quote(f.Value))
 }
 
 // Pretty returns a formatted string representing this Torrent
@@ -139,22 +225,27 @@ func (f *File) Pretty() string {
 
 // New returns a new instance of `RTorrent`
 // Pass in a true value for `insecure` to turn off certificate verification
-func New(addr string, insecure bool) *RTorrent {
+//
+// Options configure the underlying XMLRPC client, e.g. authentication:
+//  New("https://example.com/RPC2", false, xmlrpc.WithDigestAuth("user", "pass"))
+func New(addr string, insecure bool, opts ...xmlrpc.Option) *RTorrent {
 	return &RTorrent{
 		addr:         addr,
-		xmlrpcClient: xmlrpc.NewClient(addr, insecure),
+		opts:         opts,
+		xmlrpcClient: xmlrpc.NewClient(addr, insecure, opts...),
 	}
 }
 
 // WithHTTPClient allows you to a provide a custom http.Client.
+// The options passed to New are applied to it as well.
 func (r *RTorrent) WithHTTPClient(client *http.Client) *RTorrent {
-	r.xmlrpcClient = xmlrpc.NewClientWithHTTPClient(r.addr, client)
+	r.xmlrpcClient = xmlrpc.NewClientWithHTTPClient(r.addr, client, r.opts...)
 	return r
 }
 
 // AddStopped adds a new torrent by URL in a stopped state
 //
-// extraArgs can be any valid rTorrent rpc command. For instance:
+// commands are run by rTorrent on the torrent once it is loaded, their values are escaped. For instance:
 //
 // Adds the Torrent by URL (stopped) and sets the label on the torrent
 //  AddStopped("some-url", &FieldValue{"d.custom1", "my-label"})
@@ -162,418 +253,504 @@ func (r *RTorrent) WithHTTPClient(client *http.Client) *RTorrent {
 //  AddStopped("some-url", DLabel.SetValue("my-label"))
 //
 // Adds the Torrent by URL (stopped) and  sets the label and base path
-//  AddStopped("some-url", &FieldValue{"d.custom1", "my-label"}, &FiedValue{"d.base_path", "/some/valid/path"})
+//  AddStopped("some-url", &FieldValue{"d.custom1", "my-label"}, &FieldValue{"d.directory_base", "/some/valid/path"})
 // Or:
-//  AddStopped("some-url", DLabel.SetValue("my-label"), DBasePath.SetValue("/some/valid/path"))
-func (r *RTorrent) AddStopped(url string, extraArgs ...*FieldValue) error {
-	return r.add("load.normal", []byte(url), extraArgs...)
+//  AddStopped("some-url", DLabel.SetValue("my-label"), SetDirectoryBase("/some/valid/path"))
+func (r *RTorrent) AddStopped(url string, commands ...Command) error {
+	return r.AddStoppedContext(context.Background(), url, commands...)
+}
+
+// AddStoppedContext is like AddStopped but takes a context which controls cancellation and deadlines
+func (r *RTorrent) AddStoppedContext(ctx context.Context, url string, commands ...Command) error {
+	return r.add(ctx, "load.normal", []byte(url), commands...)
 }
 
 // Add adds a new torrent by URL and starts the torrent
 //
-// extraArgs can be any valid rTorrent rpc command. For instance:
+// commands are run by rTorrent on the torrent once it is loaded, their values are escaped. For instance:
 //
 // Adds the Torrent by URL and sets the label on the torrent
-//  Add("some-url", "d.custom1.set=\"my-label\"")
-// Or:
 //  Add("some-url", DLabel.SetValue("my-label"))
 //
-// Adds the Torrent by URL and  sets the label as well as base path
-//  Add("some-url", "d.custom1.set=\"my-label\"", "d.base_path=\"/some/valid/path\"")
-// Or:
-//  Add("some-url", DLabel.SetValue("my-label"), DBasePath.SetValue("/some/valid/path"))
-func (r *RTorrent) Add(url string, extraArgs ...*FieldValue) error {
-	return r.add("load.start", []byte(url), extraArgs...)
+// Adds the Torrent by URL and  sets the label, base path and priority
+//  Add("some-url", DLabel.SetValue("my-label"), SetDirectoryBase("/some/valid/path"), SetPriority(PriorityHigh))
+func (r *RTorrent) Add(url string, commands ...Command) error {
+	return r.AddContext(context.Background(), url, commands...)
+}
+
+// AddContext is like Add but takes a context which controls cancellation and deadlines
+func (r *RTorrent) AddContext(ctx context.Context, url string, commands ...Command) error {
+	return r.add(ctx, "load.start", []byte(url), commands...)
 }
 
 // AddTorrentStopped adds a new torrent by the torrent files data but does not start the torrent
 //
-// extraArgs can be any valid rTorrent rpc command. For instance:
+// commands are run by rTorrent on the torrent once it is loaded, their values are escaped. For instance:
 //
 // Adds the Torrent file (stopped) and sets the label on the torrent
-//  AddTorrentStopped(fileData, "d.custom1.set=\"my-label\"")
-// Or:
 //  AddTorrentStopped(fileData, DLabel.SetValue("my-label"))
 //
-// Adds the Torrent file and (stopped) sets the label and base path
-//  AddTorrentStopped(fileData, "d.custom1.set=\"my-label\"", "d.base_path=\"/some/valid/path\"")
-// Or:
-//  AddTorrentStopped(fileData, DLabel.SetValue("my-label"), DBasePath.SetValue("/some/valid/path"))
-func (r *RTorrent) AddTorrentStopped(data []byte, extraArgs ...*FieldValue) error {
-	return r.add("load.raw", data, extraArgs...)
+// Adds the Torrent file and (stopped) sets the label and a custom value
+//  AddTorrentStopped(fileData, DLabel.SetValue("my-label"), SetCustom("source", "rss"))
+func (r *RTorrent) AddTorrentStopped(data []byte, commands ...Command) error {
+	return r.AddTorrentStoppedContext(context.Background(), data, commands...)
+}
+
+// AddTorrentStoppedContext is like AddTorrentStopped but takes a context which controls cancellation and deadlines
+func (r *RTorrent) AddTorrentStoppedContext(ctx context.Context, data []byte, commands ...Command) error {
+	return r.add(ctx, "load.raw", data, commands...)
 }
 
 // AddTorrent adds a new torrent by the torrent files data and starts the torrent
 //
-// extraArgs can be any valid rTorrent rpc command. For instance:
+// commands are run by rTorrent on the torrent once it is loaded, their values are escaped. For instance:
 //
 // Adds the Torrent file and sets the label on the torrent
-//  Add(fileData, "d.custom1.set=\"my-label\"")
-// Or:
 //  AddTorrent(fileData, DLabel.SetValue("my-label"))
 //
 // Adds the Torrent file and  sets the label and base path
-//  Add(fileData, "d.custom1.set=\"my-label\"", "d.base_path=\"/some/valid/path\"")
-// Or:
-//  AddTorrent(fileData, DLabel.SetValue("my-label"), DBasePath.SetValue("/some/valid/path"))
-func (r *RTorrent) AddTorrent(data []byte, extraArgs ...*FieldValue) error {
-	return r.add("load.raw_start", data, extraArgs...)
+//  AddTorrent(fileData, DLabel.SetValue("my-label"), SetDirectoryBase("/some/valid/path"))
+func (r *RTorrent) AddTorrent(data []byte, commands ...Command) error {
+	return r.AddTorrentContext(context.Background(), data, commands...)
 }
 
-func (r *RTorrent) add(cmd string, data []byte, extraArgs ...*FieldValue) error {
-	args := []interface{}{data}
-	for _, v := range extraArgs {
-		args = append(args, v.String())
-	}
+// AddTorrentContext is like AddTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) AddTorrentContext(ctx context.Context, data []byte, commands ...Command) error {
+	return r.add(ctx, "load.raw_start", data, commands...)
+}
 
-	_, err := r.xmlrpcClient.Call(cmd, "", args)
+func (r *RTorrent) add(ctx context.Context, cmd string, data []byte, commands ...Command) error {
+	extraArgs, err := commandArgs(commands)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("%s XMLRPC call failed", cmd))
+		return err
 	}
-	return nil
+	args := append([]interface{}{data}, extraArgs...)
+
+	return r.call(ctx, nil, cmd, "", args)
 }
 
 // IP returns the IP reported by this RTorrent instance
 func (r *RTorrent) IP() (string, error) {
-	result, err := r.xmlrpcClient.Call("network.bind_address")
-	if err != nil {
-		return "", errors.Wrap(err, "network.bind_address XMLRPC call failed")
-	}
-	if ips, ok := result.([]interface{}); ok {
-		result = ips[0]
-	}
-	if ip, ok := result.(string); ok {
-		return ip, nil
+	return r.IPContext(context.Background())
+}
+
+// IPContext is like IP but takes a context which controls cancellation and deadlines
+func (r *RTorrent) IPContext(ctx context.Context) (string, error) {
+	var result string
+	if err := r.call(ctx, &result, "network.bind_address"); err != nil {
+		return "", err
 	}
-	return "", errors.Errorf("result isn't string: %v", result)
+	return result, nil
 }
 
 // Name returns the name reported by this RTorrent instance
 func (r *RTorrent) Name() (string, error) {
-	result, err := r.xmlrpcClient.Call("system.hostname")
-	if err != nil {
-		return "", errors.Wrap(err, "system.hostname XMLRPC call failed")
-	}
-	if names, ok := result.([]interface{}); ok {
-		result = names[0]
-	}
-	if name, ok := result.(string); ok {
-		return name, nil
+	return r.NameContext(context.Background())
+}
+
+// NameContext is like Name but takes a context which controls cancellation and deadlines
+func (r *RTorrent) NameContext(ctx context.Context) (string, error) {
+	var result string
+	if err := r.call(ctx, &result, "system.hostname"); err != nil {
+		return "", err
 	}
-	return "", errors.Errorf("result isn't string: %v", result)
+	return result, nil
 }
 
 // DownTotal returns the total downloaded metric reported by this RTorrent instance (bytes)
-func (r *RTorrent) DownTotal() (int, error) {
-	result, err := r.xmlrpcClient.Call("throttle.global_down.total")
-	if err != nil {
-		return 0, errors.Wrap(err, "throttle.global_down.total XMLRPC call failed")
-	}
-	if totals, ok := result.([]interface{}); ok {
-		result = totals[0]
-	}
-	if total, ok := result.(int); ok {
-		return total, nil
+func (r *RTorrent) DownTotal() (int64, error) {
+	return r.DownTotalContext(context.Background())
+}
+
+// DownTotalContext is like DownTotal but takes a context which controls cancellation and deadlines
+func (r *RTorrent) DownTotalContext(ctx context.Context) (int64, error) {
+	var result int64
+	if err := r.call(ctx, &result, "throttle.global_down.total"); err != nil {
+		return 0, err
 	}
-	return 0, errors.Errorf("result isn't int: %v", result)
+	return result, nil
 }
 
 // DownRate returns the current download rate reported by this RTorrent instance (bytes/s)
 func (r *RTorrent) DownRate() (int, error) {
-	result, err := r.xmlrpcClient.Call("throttle.global_down.rate")
-	if err != nil {
-		return 0, errors.Wrap(err, "throttle.global_down.rate XMLRPC call failed")
-	}
-	if totals, ok := result.([]interface{}); ok {
-		result = totals[0]
-	}
-	if total, ok := result.(int); ok {
-		return total, nil
+	return r.DownRateContext(context.Background())
+}
+
+// DownRateContext is like DownRate but takes a context which controls cancellation and deadlines
+func (r *RTorrent) DownRateContext(ctx context.Context) (int, error) {
+	var result int
+	if err := r.call(ctx, &result, "throttle.global_down.rate"); err != nil {
+		return 0, err
 	}
-	return 0, errors.Errorf("result isn't int: %v", result)
+	return result, nil
 }
 
 // UpTotal returns the total uploaded metric reported by this RTorrent instance (bytes)
-func (r *RTorrent) UpTotal() (int, error) {
-	result, err := r.xmlrpcClient.Call("throttle.global_up.total")
-	if err != nil {
-		return 0, errors.Wrap(err, "throttle.global_up.total XMLRPC call failed")
-	}
-	if totals, ok := result.([]interface{}); ok {
-		result = totals[0]
-	}
-	if total, ok := result.(int); ok {
-		return total, nil
+func (r *RTorrent) UpTotal() (int64, error) {
+	return r.UpTotalContext(context.Background())
+}
+
+// UpTotalContext is like UpTotal but takes a context which controls cancellation and deadlines
+func (r *RTorrent) UpTotalContext(ctx context.Context) (int64, error) {
+	var result int64
+	if err := r.call(ctx, &result, "throttle.global_up.total"); err != nil {
+		return 0, err
 	}
-	return 0, errors.Errorf("result isn't int: %v", result)
+	return result, nil
 }
 
 // UpRate returns the current upload rate reported by this RTorrent instance (bytes/s)
 func (r *RTorrent) UpRate() (int, error) {
-	result, err := r.xmlrpcClient.Call("throttle.global_up.rate")
-	if err != nil {
-		return 0, errors.Wrap(err, "throttle.global_up.rate XMLRPC call failed")
-	}
-	if totals, ok := result.([]interface{}); ok {
-		result = totals[0]
-	}
-	if total, ok := result.(int); ok {
-		return total, nil
+	return r.UpRateContext(context.Background())
+}
+
+// UpRateContext is like UpRate but takes a context which controls cancellation and deadlines
+func (r *RTorrent) UpRateContext(ctx context.Context) (int, error) {
+	var result int
+	if err := r.call(ctx, &result, "throttle.global_up.rate"); err != nil {
+		return 0, err
 	}
-	return 0, errors.Errorf("result isn't int: %v", result)
+	return result, nil
 }
 
 // GetTorrents returns all of the torrents reported by this RTorrent instance
 func (r *RTorrent) GetTorrents(view View) ([]Torrent, error) {
-	args := []interface{}{"", string(view), DName.Query(), DSizeInBytes.Query(), DHash.Query(), DLabel.Query(), DDirectory.Query(), DIsActive.Query(), DComplete.Query(), DRatio.Query(), DCreationTime.Query(), DFinishedTime.Query(), DStartedTime.Query()}
-	results, err := r.xmlrpcClient.Call("d.multicall2", args...)
+	return r.GetTorrentsContext(context.Background(), view)
+}
+
+// GetTorrentsContext is like GetTorrents but takes a context which controls cancellation and deadlines
+func (r *RTorrent) GetTorrentsContext(ctx context.Context, view View) ([]Torrent, error) {
 	var torrents []Torrent
+	err := r.EachTorrentContext(ctx, view, func(t Torrent) error {
+		torrents = append(torrents, t)
+		return nil
+	})
 	if err != nil {
-		return torrents, errors.Wrap(err, "d.multicall2 XMLRPC call failed")
-	}
-	for _, outerResult := range results.([]interface{}) {
-		for _, innerResult := range outerResult.([]interface{}) {
-			torrentData := innerResult.([]interface{})
-			torrents = append(torrents, Torrent{
-				Hash:      torrentData[2].(string),
-				Name:      torrentData[0].(string),
-				Path:      torrentData[4].(string),
-				Size:      torrentData[1].(int),
-				Label:     torrentData[3].(string),
-				Completed: torrentData[6].(int) > 0,
-				Ratio:     float64(torrentData[7].(int)) / float64(1000),
-				Created:   time.Unix(int64(torrentData[8].(int)), 0),
-				Finished:  time.Unix(int64(torrentData[9].(int)), 0),
-				Started:   time.Unix(int64(torrentData[10].(int)), 0),
-			})
-		}
+		return nil, err
 	}
 	return torrents, nil
 }
 
+// EachTorrent calls fn with each of the torrents in view.
+// The response is decoded while it is received, so the torrents are never held in memory all at once,
+// which is much cheaper than GetTorrents for instances with tens of thousands of torrents.
+// An error returned by fn stops the iteration and is returned.
+func (r *RTorrent) EachTorrent(view View, fn func(Torrent) error) error {
+	return r.EachTorrentContext(context.Background(), view, fn)
+}
+
+// EachTorrentContext is like EachTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) EachTorrentContext(ctx context.Context, view View, fn func(Torrent) error) error {
+	args := []interface{}{"", string(view), DName.Query(), DSizeInBytes.Query(), DHash.Query(), DLabel.Query(), DDirectory.Query(), DIsActive.Query(), DComplete.Query(), DRatio.Query(), DCreationTime.Query(), DFinishedTime.Query(), DStartedTime.Query()}
+	return r.each(ctx, "d.multicall2", args, func(elem interface{}) error {
+		var row struct {
+			Name      string
+			Size      int64
+			Hash      string
+			Label     string
+			Path      string
+			IsActive  bool
+			Completed bool
+			Ratio     int
+			Created   time.Time
+			Finished  time.Time
+			Started   time.Time
+		}
+		if err := xmlrpc.Decode(elem, &row); err != nil {
+			return &UnexpectedResponseError{Method: "d.multicall2", Value: elem, Err: err}
+		}
+		return fn(Torrent{
+			Hash:      row.Hash,
+			Name:      row.Name,
+			Path:      row.Path,
+			Size:      row.Size,
+			Label:     row.Label,
+			Completed: row.Completed,
+			Ratio:     float64(row.Ratio) / float64(1000),
+			Created:   row.Created,
+			Finished:  row.Finished,
+			Started:   row.Started,
+		})
+	})
+}
+
 // GetTorrent returns the torrent identified by the given hash
 func (r *RTorrent) GetTorrent(hash string) (Torrent, error) {
+	return r.GetTorrentContext(context.Background(), hash)
+}
+
+// GetTorrentContext is like GetTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) GetTorrentContext(ctx context.Context, hash string) (Torrent, error) {
 	var t Torrent
+	var fields struct {
+		Name      string
+		Size      int64
+		Label     string
+		Path      string
+		Completed bool
+		Ratio     int
+		Created   time.Time
+		Finished  time.Time
+		Started   time.Time
+	}
 	t.Hash = hash
-	// Name
-	results, err := r.xmlrpcClient.Call("d.name", t.Hash)
-	if err != nil {
-		return t, errors.Wrap(err, "d.name XMLRPC call failed")
+	if err := r.multicall(ctx, &fields, hash, DName, DSizeInBytes, DLabel, DDirectory, DComplete, DRatio, DCreationTime, DFinishedTime, DStartedTime); err != nil {
+		return t, err
+	}
+	t.Name = fields.Name
+	t.Size = fields.Size
+	t.Label = fields.Label
+	t.Path = fields.Path
+	t.Completed = fields.Completed
+	t.Ratio = float64(fields.Ratio) / float64(1000)
+	t.Created = fields.Created
+	t.Finished = fields.Finished
+	t.Started = fields.Started
+
+	return t, nil
+}
+
+// each streams the array returned by method to fn, see xmlrpc.Client.CallEach
+func (r *RTorrent) each(ctx context.Context, method string, args []interface{}, fn func(elem interface{}) error) error {
+	var fnErr error
+	err := r.xmlrpcClient.CallEach(ctx, method, args, func(elem interface{}) error {
+		fnErr = fn(elem)
+		return fnErr
+	})
+	if err == nil || err == fnErr {
+		return err
 	}
-	t.Name = results.([]interface{})[0].(string)
-	// Size
-	results, err = r.xmlrpcClient.Call("d.size_bytes", t.Hash)
-	if err != nil {
-		return t, errors.Wrap(err, "d.size_bytes XMLRPC call failed")
+	var decodeErr *xmlrpc.DecodeError
+	if errors.As(err, &decodeErr) {
+		return &UnexpectedResponseError{Method: method, Value: decodeErr.Value, Err: err}
 	}
-	t.Size = results.([]interface{})[0].(int)
-	// Label
-	results, err = r.xmlrpcClient.Call("d.custom1", t.Hash)
+	return errors.Wrap(mapFault(err), fmt.Sprintf("%s XMLRPC call failed", method))
+}
+
+// call calls the method with the given args and decodes its result into target, which may be nil to ignore the result
+func (r *RTorrent) call(ctx context.Context, target interface{}, method string, args ...interface{}) error {
+	result, err := r.xmlrpcClient.CallContext(ctx, method, args...)
 	if err != nil {
-		return t, errors.Wrap(err, "d.custom1 XMLRPC call failed")
+		return errors.Wrap(mapFault(err), fmt.Sprintf("%s XMLRPC call failed", method))
 	}
-	t.Label = results.([]interface{})[0].(string)
-	// Path
-	results, err = r.xmlrpcClient.Call("d.directory", t.Hash)
-	if err != nil {
-		return t, errors.Wrap(err, "d.directory XMLRPC call failed")
+	if target == nil {
+		return nil
 	}
-	t.Path = results.([]interface{})[0].(string)
-	// Completed
-	results, err = r.xmlrpcClient.Call("d.complete", t.Hash)
-	if err != nil {
-		return t, errors.Wrap(err, "d.complete XMLRPC call failed")
+	// a response carries exactly one param holding the actual value
+	params, ok := result.([]interface{})
+	if !ok || len(params) != 1 {
+		return &UnexpectedResponseError{Method: method, Value: result, Err: errors.New("expected a single param")}
 	}
-	t.Completed = results.([]interface{})[0].(int) > 0
-	// Ratio
-	results, err = r.xmlrpcClient.Call("d.ratio", t.Hash)
-	if err != nil {
-		return t, errors.Wrap(err, "d.ratio XMLRPC call failed")
+	if err := xmlrpc.Decode(params[0], target); err != nil {
+		return &UnexpectedResponseError{Method: method, Value: result, Err: err}
 	}
-	t.Ratio = float64(results.([]interface{})[0].(int)) / float64(1000)
-	// Created
-	results, err = r.xmlrpcClient.Call(string(DCreationTime), t.Hash)
-	if err != nil {
-		return t, errors.Wrap(err, fmt.Sprintf("%s XMLRPC call failed", string(DCreationTime)))
+	return nil
+}
+
+// multicall fetches the given fields of the item identified by hash in a single system.multicall round trip
+// The values are decoded positionally into the fields of the struct pointed to by target
+func (r *RTorrent) multicall(ctx context.Context, target interface{}, hash string, fields ...Field) error {
+	batch := r.xmlrpcClient.NewBatch()
+	for _, field := range fields {
+		batch.Add(field.Cmd(), hash)
 	}
-	t.Created = time.Unix(int64(results.([]interface{})[0].(int)), 0)
-	// Finished
-	results, err = r.xmlrpcClient.Call(string(DFinishedTime), t.Hash)
+	results, err := batch.RunContext(ctx)
 	if err != nil {
-		return t, errors.Wrap(err, fmt.Sprintf("%s XMLRPC call failed", string(DFinishedTime)))
+		var decodeErr *xmlrpc.DecodeError
+		if errors.As(err, &decodeErr) {
+			return &UnexpectedResponseError{Method: "system.multicall", Value: decodeErr.Value, Err: err}
+		}
+		return errors.Wrap(mapFault(err), "system.multicall XMLRPC call failed")
 	}
-	t.Finished = time.Unix(int64(results.([]interface{})[0].(int)), 0)
-	// Started
-	results, err = r.xmlrpcClient.Call(string(DStartedTime), t.Hash)
-	if err != nil {
-		return t, errors.Wrap(err, fmt.Sprintf("%s XMLRPC call failed", string(DStartedTime)))
+	values := make([]interface{}, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			return errors.Wrap(mapFault(result.Err), fmt.Sprintf("%s XMLRPC call failed", result.Method))
+		}
+		values[i] = result.Value
 	}
-	t.Created = time.Unix(int64(results.([]interface{})[0].(int)), 0)
-
-	return t, nil
+	if err := xmlrpc.Decode(values, target); err != nil {
+		return &UnexpectedResponseError{Method: "system.multicall", Value: values, Err: err}
+	}
+	return nil
 }
 
 // Delete removes the torrent
 func (r *RTorrent) Delete(t Torrent) error {
-	_, err := r.xmlrpcClient.Call("d.erase", t.Hash)
-	if err != nil {
-		return errors.Wrap(err, "d.erase XMLRPC call failed")
-	}
-	return nil
+	return r.DeleteContext(context.Background(), t)
+}
+
+// DeleteContext is like Delete but takes a context which controls cancellation and deadlines
+func (r *RTorrent) DeleteContext(ctx context.Context, t Torrent) error {
+	return r.call(ctx, nil, "d.erase", t.Hash)
 }
 
 // GetFiles returns all of the files for a given `Torrent`
 func (r *RTorrent) GetFiles(t Torrent) ([]File, error) {
+	return r.GetFilesContext(context.Background(), t)
+}
+
+// GetFilesContext is like GetFiles but takes a context which controls cancellation and deadlines
+func (r *RTorrent) GetFilesContext(ctx context.Context, t Torrent) ([]File, error) {
 	args := []interface{}{t.Hash, 0, FPath.Query(), FSizeInBytes.Query()}
-	results, err := r.xmlrpcClient.Call("f.multicall", args...)
+	var rows []struct {
+		Path string
+		Size int64
+	}
 	var files []File
-	if err != nil {
-		return files, errors.Wrap(err, "f.multicall XMLRPC call failed")
-	}
-	for _, outerResult := range results.([]interface{}) {
-		for _, innerResult := range outerResult.([]interface{}) {
-			fileData := innerResult.([]interface{})
-			files = append(files, File{
-				Path: fileData[0].(string),
-				Size: fileData[1].(int),
-			})
-		}
+	if err := r.call(ctx, &rows, "f.multicall", args...); err != nil {
+		return files, err
+	}
+	for _, row := range rows {
+		files = append(files, File{
+			Path: row.Path,
+			Size: row.Size,
+		})
 	}
 	return files, nil
 }
 
 // SetLabel sets the label on the given Torrent
 func (r *RTorrent) SetLabel(t Torrent, newLabel string) error {
+	return r.SetLabelContext(context.Background(), t, newLabel)
+}
+
+// SetLabelContext is like SetLabel but takes a context which controls cancellation and deadlines
+func (r *RTorrent) SetLabelContext(ctx context.Context, t Torrent, newLabel string) error {
 	t.Label = newLabel
 	args := []interface{}{t.Hash, newLabel}
-	if _, err := r.xmlrpcClient.Call("d.custom1.set", args...); err != nil {
-		return errors.Wrap(err, "d.custom1.set XMLRPC call failed")
-	}
-	return nil
+	return r.call(ctx, nil, "d.custom1.set", args...)
 }
 
 // GetStatus returns the Status for a given Torrent
 func (r *RTorrent) GetStatus(t Torrent) (Status, error) {
+	return r.GetStatusContext(context.Background(), t)
+}
+
+// GetStatusContext is like GetStatus but takes a context which controls cancellation and deadlines
+func (r *RTorrent) GetStatusContext(ctx context.Context, t Torrent) (Status, error) {
 	var s Status
-	// Completed
-	results, err := r.xmlrpcClient.Call("d.complete", t.Hash)
-	if err != nil {
-		return s, errors.Wrap(err, "d.complete XMLRPC call failed")
-	}
-	s.Completed = results.([]interface{})[0].(int) > 0
-	// CompletedBytes
-	results, err = r.xmlrpcClient.Call("d.completed_bytes", t.Hash)
-	if err != nil {
-		return s, errors.Wrap(err, "d.completed_bytes XMLRPC call failed")
-	}
-	s.CompletedBytes = results.([]interface{})[0].(int)
-	// DownRate
-	results, err = r.xmlrpcClient.Call("d.down.rate", t.Hash)
-	if err != nil {
-		return s, errors.Wrap(err, "d.down.rate XMLRPC call failed")
-	}
-	s.DownRate = results.([]interface{})[0].(int)
-	// UpRate
-	results, err = r.xmlrpcClient.Call("d.up.rate", t.Hash)
-	if err != nil {
-		return s, errors.Wrap(err, "d.up.rate XMLRPC call failed")
-	}
-	s.UpRate = results.([]interface{})[0].(int)
-	// Ratio
-	results, err = r.xmlrpcClient.Call("d.ratio", t.Hash)
-	if err != nil {
-		return s, errors.Wrap(err, "d.ratio XMLRPC call failed")
-	}
-	s.Ratio = float64(results.([]interface{})[0].(int)) / float64(1000)
-	// Size
-	results, err = r.xmlrpcClient.Call("d.size_bytes", t.Hash)
-	if err != nil {
-		return s, errors.Wrap(err, "d.size_bytes XMLRPC call failed")
-	}
-	s.Size = results.([]interface{})[0].(int)
+	var fields struct {
+		Completed      bool
+		CompletedBytes int64
+		DownRate       int
+		UpRate         int
+		Ratio          int
+		Size           int64
+	}
+	if err := r.multicall(ctx, &fields, t.Hash, DComplete, DCompletedBytes, DDownRate, DUpRate, DRatio, DSizeInBytes); err != nil {
+		return s, err
+	}
+	s.Completed = fields.Completed
+	s.CompletedBytes = fields.CompletedBytes
+	s.DownRate = fields.DownRate
+	s.UpRate = fields.UpRate
+	s.Ratio = float64(fields.Ratio) / float64(1000)
+	s.Size = fields.Size
 	return s, nil
 }
 
 // StartTorrent starts the torrent
 func (r *RTorrent) StartTorrent(t Torrent) error {
-	_, err := r.xmlrpcClient.Call("d.start", t.Hash)
-	if err != nil {
-		return errors.Wrap(err, "d.start XMLRPC call failed")
-	}
-	return nil
+	return r.StartTorrentContext(context.Background(), t)
+}
+
+// StartTorrentContext is like StartTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) StartTorrentContext(ctx context.Context, t Torrent) error {
+	return r.call(ctx, nil, "d.start", t.Hash)
 }
 
 // StopTorrent stops the torrent
 func (r *RTorrent) StopTorrent(t Torrent) error {
-	_, err := r.xmlrpcClient.Call("d.stop", t.Hash)
-	if err != nil {
-		return errors.Wrap(err, "d.stop XMLRPC call failed")
-	}
-	return nil
+	return r.StopTorrentContext(context.Background(), t)
+}
+
+// StopTorrentContext is like StopTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) StopTorrentContext(ctx context.Context, t Torrent) error {
+	return r.call(ctx, nil, "d.stop", t.Hash)
 }
 
 // CloseTorrent closes the torrent
 func (r *RTorrent) CloseTorrent(t Torrent) error {
-	_, err := r.xmlrpcClient.Call("d.close", t.Hash)
-	if err != nil {
-		return errors.Wrap(err, "d.close XMLRPC call failed")
-	}
-	return nil
+	return r.CloseTorrentContext(context.Background(), t)
+}
+
+// CloseTorrentContext is like CloseTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) CloseTorrentContext(ctx context.Context, t Torrent) error {
+	return r.call(ctx, nil, "d.close", t.Hash)
 }
 
 // OpenTorrent opens the torrent
 func (r *RTorrent) OpenTorrent(t Torrent) error {
-	_, err := r.xmlrpcClient.Call("d.open", t.Hash)
-	if err != nil {
-		return errors.Wrap(err, "d.open XMLRPC call failed")
-	}
-	return nil
+	return r.OpenTorrentContext(context.Background(), t)
+}
+
+// OpenTorrentContext is like OpenTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) OpenTorrentContext(ctx context.Context, t Torrent) error {
+	return r.call(ctx, nil, "d.open", t.Hash)
 }
 
 // PauseTorrent pauses the torrent
 func (r *RTorrent) PauseTorrent(t Torrent) error {
-	_, err := r.xmlrpcClient.Call("d.pause", t.Hash)
-	if err != nil {
-		return errors.Wrap(err, "d.pause XMLRPC call failed")
-	}
-	return nil
+	return r.PauseTorrentContext(context.Background(), t)
+}
+
+// PauseTorrentContext is like PauseTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) PauseTorrentContext(ctx context.Context, t Torrent) error {
+	return r.call(ctx, nil, "d.pause", t.Hash)
 }
 
 // ResumeTorrent resumes the torrent
 func (r *RTorrent) ResumeTorrent(t Torrent) error {
-	_, err := r.xmlrpcClient.Call("d.resume", t.Hash)
-	if err != nil {
-		return errors.Wrap(err, "d.resume XMLRPC call failed")
-	}
-	return nil
+	return r.ResumeTorrentContext(context.Background(), t)
+}
+
+// ResumeTorrentContext is like ResumeTorrent but takes a context which controls cancellation and deadlines
+func (r *RTorrent) ResumeTorrentContext(ctx context.Context, t Torrent) error {
+	return r.call(ctx, nil, "d.resume", t.Hash)
 }
 
 // IsActive checks if the torrent is active
 func (r *RTorrent) IsActive(t Torrent) (bool, error) {
-	results, err := r.xmlrpcClient.Call("d.is_active", t.Hash)
-	if err != nil {
-		return false, errors.Wrap(err, "d.is_active XMLRPC call failed")
+	return r.IsActiveContext(context.Background(), t)
+}
+
+// IsActiveContext is like IsActive but takes a context which controls cancellation and deadlines
+func (r *RTorrent) IsActiveContext(ctx context.Context, t Torrent) (bool, error) {
+	var active int
+	if err := r.call(ctx, &active, "d.is_active", t.Hash); err != nil {
+		return false, err
 	}
 	// active = 1; inactive = 0
-	return results.([]interface{})[0].(int) == 1, nil
+	return active == 1, nil
 }
 
 // IsOpen checks if the torrent is open
 func (r *RTorrent) IsOpen(t Torrent) (bool, error) {
-	results, err := r.xmlrpcClient.Call("d.is_open", t.Hash)
-	if err != nil {
-		return false, errors.Wrap(err, "d.is_open XMLRPC call failed")
+	return r.IsOpenContext(context.Background(), t)
+}
+
+// IsOpenContext is like IsOpen but takes a context which controls cancellation and deadlines
+func (r *RTorrent) IsOpenContext(ctx context.Context, t Torrent) (bool, error) {
+	var open int
+	if err := r.call(ctx, &open, "d.is_open", t.Hash); err != nil {
+		return false, err
 	}
 	// open = 1; closed = 0
-	return results.([]interface{})[0].(int) == 1, nil
+	return open == 1, nil
 }
 
 // State returns the state that the torrent is into
 // It returns: 0 for stopped, 1 for started/paused
 func (r *RTorrent) State(t Torrent) (int, error) {
-	results, err := r.xmlrpcClient.Call("d.state", t.Hash)
-	if err != nil {
-		return 0, errors.Wrap(err, "d.state XMLRPC call failed")
+	return r.StateContext(context.Background(), t)
+}
+
+// StateContext is like State but takes a context which controls cancellation and deadlines
+func (r *RTorrent) StateContext(ctx context.Context, t Torrent) (int, error) {
+	var state int
+	if err := r.call(ctx, &state, "d.state", t.Hash); err != nil {
+		return 0, err
 	}
-	return results.([]interface{})[0].(int), nil
+	return state, nil
 }
@@ -1,20 +1,45 @@
 package rtorrent
 
 import (
+	"bytes"
+	"context"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/mrobinsn/go-rtorrent/rtorrent/rtorrenttest"
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
+const fedoraURL = "https://torrent.fedoraproject.org/torrents/Fedora-i3-Live-x86_64-35.torrent"
+
+// testAddr returns the address of the rTorrent instance to test against.
+// Set RTORRENT_ADDR to test against a real instance, otherwise an in-process rtorrenttest.Server is used.
+func testAddr(t *testing.T) string {
+	if addr := os.Getenv("RTORRENT_ADDR"); addr != "" {
+		return addr
+	}
+	data, err := ioutil.ReadFile("testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	srv := rtorrenttest.NewServer()
+	srv.AddURL(fedoraURL, data)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
 func TestRTorrent(t *testing.T) {
 	/*
-		These tests rely on a local instance of rtorrent to be running in a clean state.
-		Use the included `test.sh` script to run these tests.
+		These tests rely on an instance of rtorrent running in a clean state.
+		By default an in-process fake is started, use the included `test.sh` script to run these tests against a real instance.
 	*/
-	client := New("http://localhost:8000", false)
+	client := New(testAddr(t), false)
 	maxRetries := 60
 
 	t.Run("get ip", func(t *testing.T) {
@@ -61,7 +86,7 @@ func TestRTorrent(t *testing.T) {
 
 	t.Run("add", func(t *testing.T) {
 		t.Run("by url", func(t *testing.T) {
-			err := client.Add("https://torrent.fedoraproject.org/torrents/Fedora-i3-Live-x86_64-35.torrent")
+			err := client.Add(fedoraURL)
 			require.NoError(t, err)
 
 			t.Run("get torrent", func(t *testing.T) {
@@ -85,7 +110,7 @@ func TestRTorrent(t *testing.T) {
 				require.Equal(t, "299939CFF841ED7FFCA2B3C2A35711C12589632B", torrents[0].Hash)
 				require.Equal(t, "Fedora-i3-Live-x86_64-35", torrents[0].Name)
 				require.Equal(t, "", torrents[0].Label)
-				require.Equal(t, 1437206706, torrents[0].Size)
+				require.Equal(t, int64(1437206706), torrents[0].Size)
 				require.Equal(t, "/downloads/temp/Fedora-i3-Live-x86_64-35", torrents[0].Path)
 				require.False(t, torrents[0].Completed)
 
@@ -189,7 +214,7 @@ func TestRTorrent(t *testing.T) {
 
 		t.Run("by url (stopped)", func(t *testing.T) {
 			label := DLabel.SetValue("test-label")
-			err := client.AddStopped("https://torrent.fedoraproject.org/torrents/Fedora-i3-Live-x86_64-35.torrent", label)
+			err := client.AddStopped(fedoraURL, label)
 			require.NoError(t, err)
 
 			t.Run("get torrent", func(t *testing.T) {
@@ -213,7 +238,7 @@ func TestRTorrent(t *testing.T) {
 				require.Equal(t, "299939CFF841ED7FFCA2B3C2A35711C12589632B", torrents[0].Hash)
 				require.Equal(t, "Fedora-i3-Live-x86_64-35", torrents[0].Name)
 				require.Equal(t, label.Value, torrents[0].Label)
-				require.Equal(t, 1437206706, torrents[0].Size)
+				require.Equal(t, int64(1437206706), torrents[0].Size)
 				require.Equal(t, "/downloads/temp/Fedora-i3-Live-x86_64-35", torrents[0].Path)
 				require.False(t, torrents[0].Completed)
 
@@ -510,7 +535,7 @@ func TestRTorrent(t *testing.T) {
 				require.Equal(t, "299939CFF841ED7FFCA2B3C2A35711C12589632B", torrents[0].Hash)
 				require.Equal(t, "Fedora-i3-Live-x86_64-35", torrents[0].Name)
 				require.Equal(t, "", torrents[0].Label)
-				require.Equal(t, 1437206706, torrents[0].Size)
+				require.Equal(t, int64(1437206706), torrents[0].Size)
 				require.Equal(t, "/downloads/temp/Fedora-i3-Live-x86_64-35", torrents[0].Path)
 				require.False(t, torrents[0].Completed)
 
@@ -575,7 +600,7 @@ func TestRTorrent(t *testing.T) {
 				require.Equal(t, "299939CFF841ED7FFCA2B3C2A35711C12589632B", torrents[0].Hash)
 				require.Equal(t, "Fedora-i3-Live-x86_64-35", torrents[0].Name)
 				require.Equal(t, label.Value, torrents[0].Label)
-				require.Equal(t, 1437206706, torrents[0].Size)
+				require.Equal(t, int64(1437206706), torrents[0].Size)
 
 				t.Run("delete torrent", func(t *testing.T) {
 					err := client.Delete(torrents[0])
@@ -621,3 +646,387 @@ func TestRTorrent(t *testing.T) {
 	})
 
 }
+
+func TestContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := New(srv.URL, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetTorrentsContext(ctx, ViewMain)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+
+	err = client.StartTorrentContext(ctx, Torrent{Hash: "hash"})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// fakeClient returns a client whose transport answers every request with the given body
+func fakeClient(contentType, body string) *RTorrent {
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{contentType}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+	return New("http://rtorrent/RPC2", false).WithHTTPClient(&http.Client{Transport: transport})
+}
+
+// fakeResponse returns a client whose transport answers every request with the given params
+func fakeResponse(t *testing.T, params ...interface{}) *RTorrent {
+	var b bytes.Buffer
+	require.NoError(t, xmlrpc.Marshal(&b, "", params...))
+	return fakeClient("text/xml", b.String())
+}
+
+func requireUnexpectedResponse(t *testing.T, err error, method string) {
+	t.Helper()
+	require.Error(t, err)
+	var unexpected *UnexpectedResponseError
+	require.True(t, errors.As(err, &unexpected), "unexpected error type %T: %v", err, err)
+	require.Equal(t, method, unexpected.Method)
+}
+
+func TestUnexpectedResponses(t *testing.T) {
+	torrent := Torrent{Hash: "299939CFF841ED7FFCA2B3C2A35711C12589632B"}
+
+	t.Run("get torrents", func(t *testing.T) {
+		// size is a string
+		client := fakeResponse(t, []interface{}{
+			[]interface{}{"name", "1437206706", "hash", "", "/downloads", 0, 0, 0, 0, 0, 0},
+		})
+		_, err := client.GetTorrents(ViewMain)
+		requireUnexpectedResponse(t, err, "d.multicall2")
+
+		// row is too short
+		client = fakeResponse(t, []interface{}{[]interface{}{"name", 1}})
+		_, err = client.GetTorrents(ViewMain)
+		requireUnexpectedResponse(t, err, "d.multicall2")
+
+		// only the second row is invalid, the first one is not returned either
+		client = fakeResponse(t, []interface{}{
+			[]interface{}{"name", 1437206706, "hash", "", "/downloads", 0, 0, 0, 0, 0, 0},
+			[]interface{}{"name", 1},
+		})
+		torrents, err := client.GetTorrents(ViewMain)
+		requireUnexpectedResponse(t, err, "d.multicall2")
+		require.Nil(t, torrents)
+
+		// no params at all
+		client = fakeResponse(t)
+		_, err = client.GetTorrents(ViewMain)
+		requireUnexpectedResponse(t, err, "d.multicall2")
+
+		client = fakeResponse(t, []interface{}{})
+		torrents, err = client.GetTorrents(ViewMain)
+		require.NoError(t, err)
+		require.Empty(t, torrents)
+	})
+
+	t.Run("get files", func(t *testing.T) {
+		client := fakeResponse(t, "not an array")
+		_, err := client.GetFiles(torrent)
+		requireUnexpectedResponse(t, err, "f.multicall")
+
+		client = fakeResponse(t, []interface{}{[]interface{}{"path", 1}, []interface{}{7, 1}})
+		_, err = client.GetFiles(torrent)
+		requireUnexpectedResponse(t, err, "f.multicall")
+	})
+
+	t.Run("get torrent", func(t *testing.T) {
+		// d.name returns an int
+		client := fakeResponse(t, []interface{}{
+			[]interface{}{1}, []interface{}{1}, []interface{}{""}, []interface{}{""}, []interface{}{0},
+			[]interface{}{0}, []interface{}{0}, []interface{}{0}, []interface{}{0},
+		})
+		_, err := client.GetTorrent(torrent.Hash)
+		requireUnexpectedResponse(t, err, "system.multicall")
+	})
+
+	t.Run("get status", func(t *testing.T) {
+		// fewer results than calls
+		client := fakeResponse(t, []interface{}{[]interface{}{1}})
+		_, err := client.GetStatus(torrent)
+		requireUnexpectedResponse(t, err, "system.multicall")
+	})
+
+	t.Run("is active", func(t *testing.T) {
+		client := fakeResponse(t)
+		_, err := client.IsActive(torrent)
+		requireUnexpectedResponse(t, err, "d.is_active")
+	})
+
+	t.Run("is open", func(t *testing.T) {
+		client := fakeResponse(t, "1")
+		_, err := client.IsOpen(torrent)
+		requireUnexpectedResponse(t, err, "d.is_open")
+	})
+
+	t.Run("state", func(t *testing.T) {
+		client := fakeResponse(t, 1, 2)
+		_, err := client.State(torrent)
+		requireUnexpectedResponse(t, err, "d.state")
+	})
+
+	t.Run("totals", func(t *testing.T) {
+		client := fakeResponse(t, []interface{}{})
+		_, err := client.DownTotal()
+		requireUnexpectedResponse(t, err, "throttle.global_down.total")
+		_, err = client.UpRate()
+		requireUnexpectedResponse(t, err, "throttle.global_up.rate")
+		_, err = client.Name()
+		requireUnexpectedResponse(t, err, "system.hostname")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		client := fakeClient("text/html", "<html><body><h1>502 Bad Gateway</h1></body></html>")
+		_, err := client.GetTorrents(ViewMain)
+		require.Error(t, err)
+		_, err = client.IsActive(torrent)
+		require.Error(t, err)
+	})
+}
+
+func TestLargeValues(t *testing.T) {
+	// rTorrent sends i8 values, sizes and totals exceed 32 bits on big seedboxes
+	const size = int64(5) << 40
+	const total = int64(1)<<53 + 1
+	torrent := Torrent{Hash: "299939CFF841ED7FFCA2B3C2A35711C12589632B"}
+
+	client := fakeResponse(t, []interface{}{
+		[]interface{}{"name", size, torrent.Hash, "", "/downloads", 0, 1, 0, 0, 0, 0},
+	})
+	torrents, err := client.GetTorrents(ViewMain)
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	require.Equal(t, size, torrents[0].Size)
+
+	client = fakeResponse(t, []interface{}{[]interface{}{"name/file.iso", size}})
+	files, err := client.GetFiles(torrent)
+	require.NoError(t, err)
+	require.Equal(t, []File{{Path: "name/file.iso", Size: size}}, files)
+
+	client = fakeResponse(t, []interface{}{
+		[]interface{}{1}, []interface{}{size - 1}, []interface{}{0}, []interface{}{0}, []interface{}{0}, []interface{}{size},
+	})
+	status, err := client.GetStatus(torrent)
+	require.NoError(t, err)
+	require.Equal(t, size-1, status.CompletedBytes)
+	require.Equal(t, size, status.Size)
+
+	client = fakeResponse(t, total)
+	down, err := client.DownTotal()
+	require.NoError(t, err)
+	require.Equal(t, total, down)
+	up, err := client.UpTotal()
+	require.NoError(t, err)
+	require.Equal(t, total, up)
+}
+
+func TestFaults(t *testing.T) {
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	client := New(srv.URL, false)
+	unknown := Torrent{Hash: "0000000000000000000000000000000000000000"}
+
+	t.Run("torrent not found", func(t *testing.T) {
+		_, err := client.GetTorrent(unknown.Hash)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+		require.False(t, errors.Is(err, ErrUnknownMethod))
+
+		var fault *xmlrpc.Fault
+		require.True(t, errors.As(err, &fault))
+		require.Equal(t, rtorrenttest.FaultTypeError, fault.Code)
+
+		err = client.StartTorrent(unknown)
+		require.True(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+
+		_, err = client.IsActive(unknown)
+		require.True(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		client := fakeResponse(t, xmlrpc.Fault{Code: rtorrenttest.FaultNoSuchMethod, Message: "Method 'd.is_active' not defined"})
+		_, err := client.IsActive(unknown)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrUnknownMethod), "unexpected error: %v", err)
+		require.False(t, errors.Is(err, ErrTorrentNotFound))
+
+		var fault *xmlrpc.Fault
+		require.True(t, errors.As(err, &fault))
+		require.Equal(t, "Method 'd.is_active' not defined", fault.Message)
+	})
+
+	t.Run("failed batches", func(t *testing.T) {
+		client := fakeResponse(t, xmlrpc.Fault{Code: rtorrenttest.FaultNoSuchMethod, Message: "Method 'system.multicall' not defined"})
+		_, err := client.GetStatus(unknown)
+		require.True(t, errors.Is(err, ErrUnknownMethod), "unexpected error: %v", err)
+		require.False(t, errors.Is(err, ErrTorrentNotFound))
+
+		client = fakeResponse(t, xmlrpc.Fault{Code: rtorrenttest.FaultTypeError, Message: "Could not find info-hash."})
+		_, err = client.GetTorrent(unknown.Hash)
+		require.True(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+		require.False(t, errors.Is(err, ErrUnknownMethod))
+	})
+
+	t.Run("other faults", func(t *testing.T) {
+		client := fakeResponse(t, xmlrpc.Fault{Code: -503, Message: "Invalid parameters"})
+		err := client.SetLabel(unknown, "label")
+		require.Error(t, err)
+		require.False(t, errors.Is(err, ErrUnknownMethod))
+		require.False(t, errors.Is(err, ErrTorrentNotFound))
+
+		var fault *xmlrpc.Fault
+		require.True(t, errors.As(err, &fault))
+		require.Equal(t, -503, fault.Code)
+	})
+}
+
+func TestCodecs(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	// no simulated transfer, so both clients see the same totals
+	srv.DownRate, srv.UpRate = 0, 0
+
+	xmlClient := New(srv.URL, false)
+	jsonClient := New(srv.URL, false, xmlrpc.WithCodec(xmlrpc.JSONCodec))
+	autoClient := New(srv.URL, false, xmlrpc.WithAutoCodec())
+
+	require.NoError(t, jsonClient.AddTorrentStopped(data, DLabel.SetValue("json")))
+	torrents, err := xmlClient.GetTorrents(ViewMain)
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	require.Equal(t, "json", torrents[0].Label)
+	torrent := torrents[0]
+
+	// every read method returns identical results with either codec
+	results := func(client *RTorrent) []interface{} {
+		var results []interface{}
+		add := func(v interface{}, err error) {
+			require.NoError(t, err)
+			results = append(results, v)
+		}
+		add(client.IP())
+		add(client.Name())
+		add(client.DownTotal())
+		add(client.DownRate())
+		add(client.UpTotal())
+		add(client.UpRate())
+		add(client.GetTorrents(ViewMain))
+		add(client.GetTorrent(torrent.Hash))
+		add(client.GetFiles(torrent))
+		add(client.GetStatus(torrent))
+		add(client.IsActive(torrent))
+		add(client.IsOpen(torrent))
+		add(client.State(torrent))
+		return results
+	}
+	want := results(xmlClient)
+	require.Equal(t, want, results(jsonClient))
+	require.Equal(t, want, results(autoClient))
+
+	// and actions have the same effect
+	require.NoError(t, jsonClient.SetLabel(torrent, "relabeled"))
+	require.NoError(t, jsonClient.StartTorrent(torrent))
+	torrent, err = xmlClient.GetTorrent(torrent.Hash)
+	require.NoError(t, err)
+	require.Equal(t, "relabeled", torrent.Label)
+	active, err := xmlClient.IsActive(torrent)
+	require.NoError(t, err)
+	require.True(t, active)
+
+	_, err = jsonClient.GetTorrent("0000000000000000000000000000000000000000")
+	require.True(t, errors.Is(err, ErrTorrentNotFound), "unexpected error: %v", err)
+	require.NoError(t, jsonClient.Delete(torrent))
+	torrents, err = xmlClient.GetTorrents(ViewMain)
+	require.NoError(t, err)
+	require.Empty(t, torrents)
+}
+
+func TestEachTorrent(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	client := New(srv.URL, false)
+	require.NoError(t, client.AddTorrentStopped(data, DLabel.SetValue("each")))
+
+	torrents, err := client.GetTorrents(ViewMain)
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+
+	var each []Torrent
+	require.NoError(t, client.EachTorrent(ViewMain, func(t Torrent) error {
+		each = append(each, t)
+		return nil
+	}))
+	require.Equal(t, torrents, each)
+
+	stop := errors.New("stop")
+	err = client.EachTorrent(ViewMain, func(Torrent) error { return stop })
+	require.Equal(t, stop, err)
+
+	err = fakeResponse(t, "not an array").EachTorrent(ViewMain, func(Torrent) error { return nil })
+	requireUnexpectedResponse(t, err, "d.multicall2")
+}
+
+func TestRetry(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/Fedora-i3-Live-x86_64-35.torrent")
+	require.NoError(t, err)
+	srv := rtorrenttest.NewServer()
+	defer srv.Close()
+	require.NoError(t, New(srv.URL, false).AddTorrentStopped(data))
+
+	// every other request fails, as if rTorrent was too busy to answer
+	var requests int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+	client := New(flaky.URL, false, xmlrpc.WithRetry(xmlrpc.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	torrents, err := client.GetTorrents(ViewMain)
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	require.EqualValues(t, 2, atomic.LoadInt32(&requests))
+
+	rows, err := client.Query(ViewMain, DHash)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.EqualValues(t, 4, atomic.LoadInt32(&requests))
+
+	var hashes []struct {
+		Hash string `rtorrent:"d.hash"`
+	}
+	require.NoError(t, client.QueryInto(ViewMain, &hashes))
+	require.Len(t, hashes, 1)
+	require.EqualValues(t, 6, atomic.LoadInt32(&requests))
+
+	// mutations are not retried
+	err = client.StartTorrent(torrents[0])
+	var httpErr *xmlrpc.HTTPError
+	require.True(t, errors.As(err, &httpErr), "unexpected error: %v", err)
+	require.EqualValues(t, 7, atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,731 @@
+// Package rtorrenttest provides an in-process fake rTorrent for testing code which uses the rtorrent package.
+//
+// The Server speaks XMLRPC and JSON-RPC over HTTP and keeps its torrents in memory, so tests can run without Docker
+// or network access:
+//  srv := rtorrenttest.NewServer()
+//  defer srv.Close()
+//  client := rtorrent.New(srv.URL, false)
+package rtorrenttest
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrobinsn/go-rtorrent/metainfo"
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDirectory is the download directory torrents are placed into
+	DefaultDirectory = "/downloads/temp"
+	// DefaultHostname is the hostname reported by system.hostname
+	DefaultHostname = "rtorrenttest"
+	// DefaultBindAddress is the address reported by network.bind_address
+	DefaultBindAddress = "0.0.0.0"
+	// DefaultDownRate is the simulated download rate of an active torrent (bytes/s)
+	DefaultDownRate = 1 << 20
+	// DefaultUpRate is the simulated upload rate of an active torrent (bytes/s)
+	DefaultUpRate = 64 << 10
+)
+
+// Fault codes used by rTorrent
+const (
+	// FaultTypeError is returned for invalid arguments, including unknown info-hashes
+	FaultTypeError = -501
+	// FaultNoSuchMethod is returned for methods which are not defined
+	FaultNoSuchMethod = -506
+)
+
+// Server is a fake rTorrent instance serving the XMLRPC methods used by the rtorrent package.
+// Active torrents "download" and "upload" at a fixed simulated rate.
+type Server struct {
+	*httptest.Server
+
+	// Directory is the download directory torrents are placed into
+	Directory string
+	// Hostname is reported by system.hostname
+	Hostname string
+	// BindAddress is reported by network.bind_address
+	BindAddress string
+	// DownRate is the simulated download rate of an active torrent (bytes/s)
+	DownRate int
+	// UpRate is the simulated upload rate of an active torrent (bytes/s)
+	UpRate int
+	// MetadataDelay is how long torrents added from magnet URIs take to fetch metadata registered with AddMetadata
+	MetadataDelay time.Duration
+
+	mu        sync.Mutex
+	torrents  map[string]*torrent
+	order     []string
+	urls      map[string][]byte
+	metadata  map[string][]byte
+	downTotal int64
+	upTotal   int64
+	lastTick  time.Time
+	rpc       *xmlrpc.Server
+}
+
+// file is a file within a torrent
+type file struct {
+	path string
+	size int64
+}
+
+// torrent is the state of a single loaded torrent
+type torrent struct {
+	hash      string
+	name      string
+	size      int64
+	files     []file
+	multi     bool
+	created   int
+	custom    map[string]string
+	directory string
+	priority  int
+	throttle  string
+
+	state     int
+	open      bool
+	active    bool
+	completed int64
+	uploaded  int64
+	started   int
+	finished  int
+
+	// meta is set for items fetching the metadata of a magnet URI since loaded
+	meta   bool
+	loaded time.Time
+}
+
+// NewServer starts and returns a new Server, the caller should call Close when finished
+func NewServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// NewUnstartedServer returns a new Server which is not started yet, see httptest.NewUnstartedServer
+func NewUnstartedServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewUnstartedServer(s)
+	return s
+}
+
+func newServer() *Server {
+	s := &Server{
+		Directory:   DefaultDirectory,
+		Hostname:    DefaultHostname,
+		BindAddress: DefaultBindAddress,
+		DownRate:    DefaultDownRate,
+		UpRate:      DefaultUpRate,
+		torrents:    map[string]*torrent{},
+		urls:        map[string][]byte{},
+		metadata:    map[string][]byte{},
+		lastTick:    time.Now(),
+		rpc:         xmlrpc.NewServer(),
+	}
+	s.register()
+	return s
+}
+
+// AddURL registers the .torrent data served for url, so load.normal and load.start can fetch it without network access
+func (s *Server) AddURL(url string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.urls[url] = data
+}
+
+// AddMetadata registers .torrent data as available from the swarm, so torrents added from magnet URIs with its
+// info-hash get their metadata after MetadataDelay. Until then they remain meta items, see d.is_meta.
+func (s *Server) AddMetadata(data []byte) error {
+	mi, err := metainfo.Parse(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metadata[mi.InfoHash] = data
+	return nil
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.rpc.ServeHTTP(w, r)
+}
+
+// register serves every method through the xmlrpc.Server, advancing the simulation before each call
+func (s *Server) register() {
+	for name, method := range s.methods() {
+		method := method
+		s.rpc.Register(name, func(params ...interface{}) (interface{}, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.tick(time.Now())
+			result, err := method(params)
+			if err != nil {
+				return nil, toFault(err)
+			}
+			return result, nil
+		})
+	}
+	s.rpc.NotFound = func(_ context.Context, name string, _ []interface{}) (interface{}, error) {
+		return nil, &xmlrpc.Fault{Code: FaultNoSuchMethod, Message: fmt.Sprintf("Method '%s' not defined", name)}
+	}
+}
+
+// toFault reports errors which aren't faults already with the fault code rTorrent uses for invalid input
+func toFault(err error) *xmlrpc.Fault {
+	var fault *xmlrpc.Fault
+	if errors.As(err, &fault) {
+		return fault
+	}
+	return &xmlrpc.Fault{Code: FaultTypeError, Message: err.Error()}
+}
+
+// tick advances the simulated transfers of all active torrents up to now
+func (s *Server) tick(now time.Time) {
+	elapsed := now.Sub(s.lastTick).Seconds()
+	s.lastTick = now
+	s.fetchMetadata(now)
+	for _, t := range s.torrents {
+		if !t.active {
+			continue
+		}
+		if t.completed < t.size {
+			down := int64(float64(s.DownRate) * elapsed)
+			if t.completed+down >= t.size {
+				down = t.size - t.completed
+				t.finished = int(now.Unix())
+			}
+			t.completed += down
+			s.downTotal += down
+		}
+		up := int64(float64(s.UpRate) * elapsed)
+		t.uploaded += up
+		s.upTotal += up
+	}
+}
+
+func (s *Server) methods() map[string]func(params []interface{}) (interface{}, error) {
+	m := map[string]func(params []interface{}) (interface{}, error){
+		"system.hostname":            func([]interface{}) (interface{}, error) { return s.Hostname, nil },
+		"network.bind_address":       func([]interface{}) (interface{}, error) { return s.BindAddress, nil },
+		"throttle.global_down.total": func([]interface{}) (interface{}, error) { return s.downTotal, nil },
+		"throttle.global_up.total":   func([]interface{}) (interface{}, error) { return s.upTotal, nil },
+		"throttle.global_down.rate":  func([]interface{}) (interface{}, error) { return s.globalRate(s.downRate), nil },
+		"throttle.global_up.rate":    func([]interface{}) (interface{}, error) { return s.globalRate(s.upRate), nil },
+		"load.normal":                s.load(false, false),
+		"load.start":                 s.load(true, false),
+		"load.raw":                   s.load(false, true),
+		"load.raw_start":             s.load(true, true),
+		"d.multicall2":               s.dMulticall,
+		"f.multicall":                s.fMulticall,
+		"d.erase":                    s.erase,
+	}
+	for name, get := range getters {
+		get := get
+		m[name] = s.withTorrent(func(t *torrent, _ []interface{}) (interface{}, error) {
+			return get(s, t), nil
+		})
+	}
+	for name, set := range setters {
+		name, set := name, set
+		m[name+".set"] = s.withTorrent(func(t *torrent, args []interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return nil, errors.Errorf("%s.set expects a value", name)
+			}
+			return 0, set(t, args)
+		})
+	}
+	for name, action := range actions {
+		action := action
+		m[name] = s.withTorrent(func(t *torrent, _ []interface{}) (interface{}, error) {
+			action(s, t)
+			return 0, nil
+		})
+	}
+	return m
+}
+
+func (s *Server) globalRate(rate func(*torrent) int) int {
+	total := 0
+	for _, t := range s.torrents {
+		total += rate(t)
+	}
+	return total
+}
+
+func (s *Server) downRate(t *torrent) int {
+	if t.active && t.completed < t.size {
+		return s.DownRate
+	}
+	return 0
+}
+
+func (s *Server) upRate(t *torrent) int {
+	if t.active {
+		return s.UpRate
+	}
+	return 0
+}
+
+// withTorrent looks up the torrent identified by the first param before calling fn with the remaining params
+func (s *Server) withTorrent(fn func(t *torrent, args []interface{}) (interface{}, error)) func([]interface{}) (interface{}, error) {
+	return func(params []interface{}) (interface{}, error) {
+		t, err := s.lookup(params)
+		if err != nil {
+			return nil, err
+		}
+		return fn(t, params[1:])
+	}
+}
+
+func (s *Server) lookup(params []interface{}) (*torrent, error) {
+	if len(params) > 0 {
+		if hash, ok := params[0].(string); ok {
+			if t, ok := s.torrents[strings.ToUpper(hash)]; ok {
+				return t, nil
+			}
+		}
+	}
+	return nil, &xmlrpc.Fault{Code: FaultTypeError, Message: "Could not find info-hash."}
+}
+
+var getters = map[string]func(s *Server, t *torrent) interface{}{
+	"d.hash":               func(s *Server, t *torrent) interface{} { return t.hash },
+	"d.name":               func(s *Server, t *torrent) interface{} { return t.name },
+	"d.size_bytes":         func(s *Server, t *torrent) interface{} { return t.size },
+	"d.custom1":            func(s *Server, t *torrent) interface{} { return t.custom["1"] },
+	"d.directory":          func(s *Server, t *torrent) interface{} { return t.directory },
+	"d.directory_base":     func(s *Server, t *torrent) interface{} { return t.directory },
+	"d.base_path":          func(s *Server, t *torrent) interface{} { return t.directory },
+	"d.priority":           func(s *Server, t *torrent) interface{} { return t.priority },
+	"d.throttle_name":      func(s *Server, t *torrent) interface{} { return t.throttle },
+	"d.is_active":          func(s *Server, t *torrent) interface{} { return boolInt(t.active) },
+	"d.is_open":            func(s *Server, t *torrent) interface{} { return boolInt(t.open) },
+	"d.is_meta":            func(s *Server, t *torrent) interface{} { return boolInt(t.meta) },
+	"d.state":              func(s *Server, t *torrent) interface{} { return t.state },
+	"d.complete":           func(s *Server, t *torrent) interface{} { return boolInt(!t.meta && t.completed == t.size) },
+	"d.completed_bytes":    func(s *Server, t *torrent) interface{} { return t.completed },
+	"d.down.rate":          func(s *Server, t *torrent) interface{} { return s.downRate(t) },
+	"d.up.rate":            func(s *Server, t *torrent) interface{} { return s.upRate(t) },
+	"d.ratio":              func(s *Server, t *torrent) interface{} { return t.ratio() },
+	"d.creation_date":      func(s *Server, t *torrent) interface{} { return t.created },
+	"d.timestamp.started":  func(s *Server, t *torrent) interface{} { return t.started },
+	"d.timestamp.finished": func(s *Server, t *torrent) interface{} { return t.finished },
+	"d.peers_connected":    func(s *Server, t *torrent) interface{} { return 0 },
+	"d.message":            func(s *Server, t *torrent) interface{} { return "" },
+}
+
+var setters = map[string]func(t *torrent, args []interface{}) error{
+	"d.custom1": func(t *torrent, args []interface{}) error {
+		t.custom["1"] = fmt.Sprint(args[0])
+		return nil
+	},
+	"d.custom": func(t *torrent, args []interface{}) error {
+		if len(args) != 2 {
+			return errors.New("d.custom.set expects a key and a value")
+		}
+		t.custom[fmt.Sprint(args[0])] = fmt.Sprint(args[1])
+		return nil
+	},
+	"d.directory": func(t *torrent, args []interface{}) error {
+		t.directory = fmt.Sprint(args[0])
+		if t.multi {
+			t.directory = path.Join(t.directory, t.name)
+		}
+		return nil
+	},
+	"d.directory_base": func(t *torrent, args []interface{}) error {
+		t.directory = fmt.Sprint(args[0])
+		return nil
+	},
+	"d.throttle_name": func(t *torrent, args []interface{}) error {
+		t.throttle = fmt.Sprint(args[0])
+		return nil
+	},
+	"d.priority": func(t *torrent, args []interface{}) error {
+		p, ok := args[0].(int)
+		if !ok {
+			if _, err := fmt.Sscan(fmt.Sprint(args[0]), &p); err != nil {
+				return errors.Errorf("invalid priority %v", args[0])
+			}
+		}
+		t.priority = p
+		return nil
+	},
+}
+
+var actions = map[string]func(s *Server, t *torrent){
+	"d.start": func(s *Server, t *torrent) {
+		t.state, t.open, t.active = 1, true, true
+		if t.started == 0 {
+			t.started = int(time.Now().Unix())
+		}
+	},
+	"d.stop": func(s *Server, t *torrent) {
+		t.state, t.active = 0, false
+	},
+	"d.close": func(s *Server, t *torrent) {
+		t.state, t.open, t.active = 0, false, false
+	},
+	"d.open": func(s *Server, t *torrent) {
+		t.open = true
+	},
+	"d.pause": func(s *Server, t *torrent) {
+		t.active = false
+	},
+	"d.resume": func(s *Server, t *torrent) {
+		if t.state == 1 {
+			t.open, t.active = true, true
+		}
+	},
+	"d.check_hash": func(s *Server, t *torrent) {
+		// the data is simulated, the check always finds what was "downloaded"
+	},
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (t *torrent) ratio() int {
+	if t.completed == 0 {
+		return 0
+	}
+	return int(t.uploaded * 1000 / t.completed)
+}
+
+func (s *Server) erase(params []interface{}) (interface{}, error) {
+	t, err := s.lookup(params)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.torrents, t.hash)
+	for i, hash := range s.order {
+		if hash == t.hash {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return 0, nil
+}
+
+// view returns the torrents in the given view, in the order they were loaded
+func (s *Server) view(name string) ([]*torrent, error) {
+	var filter func(t *torrent) bool
+	switch name {
+	case "", "main", "default":
+		filter = func(*torrent) bool { return true }
+	case "started":
+		filter = func(t *torrent) bool { return t.state == 1 }
+	case "stopped":
+		filter = func(t *torrent) bool { return t.state == 0 }
+	case "complete":
+		filter = func(t *torrent) bool { return t.completed == t.size }
+	case "incomplete":
+		filter = func(t *torrent) bool { return t.completed < t.size }
+	case "seeding":
+		filter = func(t *torrent) bool { return t.state == 1 && t.completed == t.size }
+	case "leeching":
+		filter = func(t *torrent) bool { return t.state == 1 && t.completed < t.size }
+	case "active":
+		filter = func(t *torrent) bool { return t.active }
+	case "hashing":
+		filter = func(*torrent) bool { return false }
+	default:
+		return nil, &xmlrpc.Fault{Code: FaultTypeError, Message: "Could not find view: " + name}
+	}
+	var torrents []*torrent
+	for _, hash := range s.order {
+		if t := s.torrents[hash]; filter(t) {
+			torrents = append(torrents, t)
+		}
+	}
+	return torrents, nil
+}
+
+// dMulticall implements d.multicall2 with the params target, view, commands...
+func (s *Server) dMulticall(params []interface{}) (interface{}, error) {
+	if len(params) < 2 {
+		return nil, errors.New("d.multicall2 expects a target and a view")
+	}
+	view, _ := params[1].(string)
+	torrents, err := s.view(view)
+	if err != nil {
+		return nil, err
+	}
+	rows := []interface{}{}
+	for _, t := range torrents {
+		row := make([]interface{}, 0, len(params)-2)
+		for _, p := range params[2:] {
+			cmd, _ := p.(string)
+			name, arg := cmd, ""
+			if i := strings.Index(cmd, "="); i >= 0 {
+				name, arg = cmd[:i], cmd[i+1:]
+			}
+			if name == "d.custom" {
+				args, err := parseArgs(arg)
+				if err != nil || len(args) != 1 {
+					return nil, &xmlrpc.Fault{Code: FaultTypeError, Message: "Wrong object type."}
+				}
+				row = append(row, t.custom[args[0].(string)])
+				continue
+			}
+			get, ok := getters[name]
+			if !ok {
+				return nil, &xmlrpc.Fault{Code: FaultNoSuchMethod, Message: fmt.Sprintf("Method '%s' not defined", cmd)}
+			}
+			row = append(row, get(s, t))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// fMulticall implements f.multicall with the params hash, index, commands...
+func (s *Server) fMulticall(params []interface{}) (interface{}, error) {
+	t, err := s.lookup(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) < 2 {
+		return nil, errors.New("f.multicall expects a hash and an index")
+	}
+	rows := []interface{}{}
+	for _, f := range t.files {
+		row := make([]interface{}, 0, len(params)-2)
+		for _, p := range params[2:] {
+			switch cmd, _ := p.(string); strings.TrimSuffix(cmd, "=") {
+			case "f.path":
+				row = append(row, f.path)
+			case "f.size_bytes":
+				row = append(row, f.size)
+			default:
+				return nil, &xmlrpc.Fault{Code: FaultNoSuchMethod, Message: fmt.Sprintf("Method '%s' not defined", cmd)}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// load implements the load.* methods with the params target, url or data, commands...
+// Arrays within the params are flattened, as rTorrent does.
+func (s *Server) load(start, raw bool) func([]interface{}) (interface{}, error) {
+	return func(params []interface{}) (interface{}, error) {
+		args := flatten(params)
+		if len(args) < 2 {
+			return nil, errors.New("load expects a target and a torrent")
+		}
+		var data []byte
+		var url string
+		if raw {
+			switch v := args[1].(type) {
+			case []byte:
+				data = v
+			case string:
+				// JSON-RPC has no binary type, raw data is sent base64 encoded
+				b, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return nil, errors.Wrap(err, "load.raw expects base64 encoded torrent data")
+				}
+				data = b
+			default:
+				return nil, errors.New("load.raw expects raw torrent data")
+			}
+		} else {
+			switch v := args[1].(type) {
+			case string:
+				url = v
+			case []byte:
+				url = string(v)
+			}
+			var ok bool
+			if data, ok = s.urls[url]; !ok && !isMagnet(url) {
+				// rTorrent loads URLs asynchronously and silently drops failures
+				return 0, nil
+			}
+		}
+
+		var t *torrent
+		var err error
+		if data == nil && isMagnet(url) {
+			if t = s.magnetTorrent(url); t == nil {
+				return 0, nil
+			}
+		} else if t, err = s.parseTorrent(data); err != nil {
+			return nil, errors.Wrap(err, "Could not create download")
+		}
+		if _, ok := s.torrents[t.hash]; ok {
+			// already loaded, rTorrent ignores duplicates
+			return 0, nil
+		}
+		for _, arg := range args[2:] {
+			cmd, _ := arg.(string)
+			if err := s.command(t, cmd); err != nil {
+				return nil, err
+			}
+		}
+		s.torrents[t.hash] = t
+		s.order = append(s.order, t.hash)
+		if start {
+			actions["d.start"](s, t)
+		}
+		return 0, nil
+	}
+}
+
+func flatten(params []interface{}) []interface{} {
+	var out []interface{}
+	for _, p := range params {
+		if list, ok := p.([]interface{}); ok {
+			out = append(out, flatten(list)...)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// command runs a post-load command such as d.custom1.set="label" against t
+func (s *Server) command(t *torrent, cmd string) error {
+	if cmd == "" {
+		return nil
+	}
+	eq := strings.Index(cmd, "=")
+	if eq < 0 {
+		return errors.Errorf("invalid command %q", cmd)
+	}
+	name := cmd[:eq]
+	args, err := parseArgs(cmd[eq+1:])
+	if err != nil {
+		return errors.Wrapf(err, "invalid command %q", cmd)
+	}
+	if action, ok := actions[name]; ok {
+		action(s, t)
+		return nil
+	}
+	set, ok := setters[strings.TrimSuffix(name, ".set")]
+	if !ok || !strings.HasSuffix(name, ".set") {
+		return &xmlrpc.Fault{Code: FaultNoSuchMethod, Message: fmt.Sprintf("Command \"%s\" does not exist.", name)}
+	}
+	if len(args) == 0 {
+		return errors.Errorf("%s expects a value", name)
+	}
+	return set(t, args)
+}
+
+// parseArgs splits the comma separated arguments of a command, honouring double quotes and backslash escapes
+func parseArgs(s string) ([]interface{}, error) {
+	var args []interface{}
+	var cur strings.Builder
+	quoted, escaped := false, false
+	for _, c := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			args = append(args, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if quoted || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if s != "" {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+func isMagnet(url string) bool {
+	return strings.HasPrefix(strings.ToLower(url), "magnet:")
+}
+
+// magnetTorrent returns the meta item fetching the metadata of a magnet URI, or nil for invalid URIs
+func (s *Server) magnetTorrent(uri string) *torrent {
+	magnet, err := metainfo.ParseMagnet(uri)
+	if err != nil || magnet.InfoHash == "" {
+		return nil
+	}
+	name := magnet.DisplayName
+	if name == "" {
+		name = magnet.InfoHash + ".meta"
+	}
+	return &torrent{
+		hash:      magnet.InfoHash,
+		name:      name,
+		custom:    map[string]string{},
+		directory: s.Directory,
+		meta:      true,
+		loaded:    time.Now(),
+	}
+}
+
+// fetchMetadata replaces the meta items whose metadata is available with the actual torrents, keeping their settings
+func (s *Server) fetchMetadata(now time.Time) {
+	for hash, t := range s.torrents {
+		data, ok := s.metadata[hash]
+		if !t.meta || !ok || now.Sub(t.loaded) < s.MetadataDelay {
+			continue
+		}
+		loaded, err := s.parseTorrent(data)
+		if err != nil {
+			continue
+		}
+		loaded.custom, loaded.priority, loaded.throttle = t.custom, t.priority, t.throttle
+		if t.directory != s.Directory {
+			setters["d.directory"](loaded, []interface{}{t.directory})
+		}
+		loaded.state, loaded.open, loaded.active, loaded.started = t.state, t.open, t.active, t.started
+		s.torrents[hash] = loaded
+	}
+}
+
+// parseTorrent reads the name, files and info-hash from .torrent data
+func (s *Server) parseTorrent(data []byte) (*torrent, error) {
+	mi, err := metainfo.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if mi.InfoHash == "" {
+		return nil, errors.New("v2-only torrents are not supported")
+	}
+	t := &torrent{
+		hash:      mi.InfoHash,
+		name:      mi.Name,
+		size:      mi.Length,
+		multi:     mi.MultiFile,
+		custom:    map[string]string{},
+		directory: s.Directory,
+	}
+	if !mi.CreationDate.IsZero() {
+		t.created = int(mi.CreationDate.Unix())
+	}
+	for _, f := range mi.Files {
+		t.files = append(t.files, file{path: f.Path, size: f.Length})
+	}
+	if t.multi {
+		t.directory = path.Join(s.Directory, t.name)
+	}
+	return t, nil
+}
@@ -0,0 +1,308 @@
+package xmlrpc
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// WithBasicAuth authenticates every request with HTTP Basic authentication
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.auth = func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req = req.Clone(req.Context())
+				req.SetBasicAuth(username, password)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+}
+
+// WithBearerToken authenticates every request with a static "Authorization: Bearer <token>" header
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.auth = func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req = req.Clone(req.Context())
+				req.Header.Set("Authorization", "Bearer "+token)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+}
+
+// WithDigestAuth authenticates requests with HTTP Digest authentication, as commonly configured for ruTorrent.
+// The first request is answered with a 401 challenge by the server and retried with credentials,
+// later requests reuse the challenge until the server reports its nonce as stale.
+func WithDigestAuth(username, password string) Option {
+	return func(c *Client) {
+		c.auth = func(next http.RoundTripper) http.RoundTripper {
+			return &challengeTransport{username: username, password: password, next: next}
+		}
+	}
+}
+
+// withChallengeAuth answers Basic as well as Digest challenges, it is used for credentials taken from the address
+func withChallengeAuth(username, password string) Option {
+	return func(c *Client) {
+		c.auth = func(next http.RoundTripper) http.RoundTripper {
+			return &challengeTransport{username: username, password: password, next: next, allowBasic: true}
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// challengeTransport authenticates requests in response to a 401 challenge of the server
+type challengeTransport struct {
+	username   string
+	password   string
+	next       http.RoundTripper
+	allowBasic bool
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	basic     bool
+	nc        int
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *challengeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	authReq, err := t.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// (re-)authenticate using the challenge of the response, once
+	if !t.accept(resp.Header.Values("WWW-Authenticate")) {
+		return resp, nil
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// the body was consumed by the first attempt and cannot be replayed
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	authReq, err = t.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(authReq)
+}
+
+// accept stores the challenge to answer, preferring Digest over Basic,
+// and reports whether authenticating again could succeed
+func (t *challengeTransport) accept(headers []string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	offersBasic := false
+	for _, h := range headers {
+		switch strings.ToLower(strings.SplitN(strings.TrimSpace(h), " ", 2)[0]) {
+		case "digest":
+			c, err := parseDigestChallenge(h)
+			if err != nil {
+				continue
+			}
+			// a challenge for the nonce we just used means the credentials were rejected, unless it is stale
+			if t.challenge != nil && t.challenge.nonce == c.nonce && !c.stale {
+				return false
+			}
+			t.challenge, t.basic, t.nc = c, false, 0
+			return true
+		case "basic":
+			offersBasic = true
+		}
+	}
+	if !offersBasic || !t.allowBasic || t.basic {
+		return false
+	}
+	t.challenge, t.basic = nil, true
+	return true
+}
+
+// authorize returns a copy of req carrying credentials for the current challenge, if any
+func (t *challengeTransport) authorize(req *http.Request) (*http.Request, error) {
+	authReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to replay request body")
+		}
+		authReq.Body = body
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.basic:
+		authReq.SetBasicAuth(t.username, t.password)
+	case t.challenge != nil:
+		t.nc++
+		header, err := t.challenge.authorization(t.username, t.password, req.Method, req.URL.RequestURI(), t.nc)
+		if err != nil {
+			return nil, err
+		}
+		authReq.Header.Set("Authorization", header)
+	}
+	return authReq, nil
+}
+
+// digestChallenge is a parsed "WWW-Authenticate: Digest ..." header, see RFC 7616
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+}
+
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "digest") {
+		return nil, errors.Errorf("not a digest challenge: %q", header)
+	}
+	params := parseAuthParams(parts[1])
+	c := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+		stale:     strings.EqualFold(params["stale"], "true"),
+	}
+	if c.nonce == "" {
+		return nil, errors.Errorf("digest challenge without nonce: %q", header)
+	}
+	if qop, ok := params["qop"]; ok {
+		for _, q := range strings.Split(qop, ",") {
+			if strings.TrimSpace(q) == "auth" {
+				c.qop = "auth"
+			}
+		}
+		if c.qop == "" {
+			return nil, errors.Errorf("unsupported digest qop %q", qop)
+		}
+	}
+	return c, nil
+}
+
+// parseAuthParams parses the comma separated key=value and key="quoted value" pairs of an auth header
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimSpace(s[eq+1:])
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+		s = strings.TrimPrefix(strings.TrimSpace(s), ",")
+	}
+	return params
+}
+
+// authorization computes the Authorization header answering the challenge
+func (c *digestChallenge) authorization(username, password, method, uri string, nc int) (string, error) {
+	var newHash func() hash.Hash
+	algorithm := strings.ToUpper(c.algorithm)
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", errors.Errorf("unsupported digest algorithm %q", c.algorithm)
+	}
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	cnonce, err := newCnonce()
+	if err != nil {
+		return "", err
+	}
+	ncValue := fmt.Sprintf("%08x", nc)
+
+	ha1 := h(username + ":" + c.realm + ":" + password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	var response string
+	if c.qop == "" {
+		response = h(ha1 + ":" + c.nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + ncValue + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	}
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		quoteEscape(username), quoteEscape(c.realm), quoteEscape(c.nonce), quoteEscape(uri), response)
+	if c.algorithm != "" {
+		header += ", algorithm=" + c.algorithm
+	}
+	if c.opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, quoteEscape(c.opaque))
+	}
+	if c.qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, c.qop, ncValue, cnonce)
+	}
+	return header, nil
+}
+
+func quoteEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate digest cnonce")
+	}
+	return hex.EncodeToString(b), nil
+}
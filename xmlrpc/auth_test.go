@@ -0,0 +1,171 @@
+package xmlrpc
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// newAuthServer starts an XMLRPC server which answers d.name calls once check accepts the request
+func newAuthServer(t *testing.T, check func(w http.ResponseWriter, r *http.Request) bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !check(w, r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		name, _, _, err := Unmarshal(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "text/xml")
+		require.NoError(t, Marshal(w, "", "called "+name))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func basicAuthCheck(w http.ResponseWriter, r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	if ok && user == "user" && pass == "secret" {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="rtorrent"`)
+	return false
+}
+
+// digestAuthCheck implements the server side of RFC 7616 digest authentication with MD5 and qop=auth
+type digestAuthCheck struct {
+	mu         sync.Mutex
+	nonce      int
+	challenges int
+	lastNC     string
+}
+
+func (d *digestAuthCheck) check(w http.ResponseWriter, r *http.Request) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	nonce := fmt.Sprintf("nonce-%d", d.nonce)
+
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Digest ") {
+		p := parseAuthParams(strings.TrimPrefix(header, "Digest "))
+		h := func(s string) string {
+			sum := md5.Sum([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}
+		ha1 := h("user:rtorrent:secret")
+		ha2 := h(r.Method + ":" + p["uri"])
+		expected := h(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":" + p["qop"] + ":" + ha2)
+		if p["username"] == "user" && p["response"] == expected && p["opaque"] == "opaque" {
+			if p["nonce"] == nonce {
+				d.lastNC = p["nc"]
+				return true
+			}
+			// valid credentials for an old nonce
+			d.challenges++
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="rtorrent", nonce="%s", opaque="opaque", qop="auth", stale=true`, nonce))
+			return false
+		}
+	}
+	d.challenges++
+	w.Header().Set("WWW-Authenticate", `Basic realm="ignored"`)
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="rtorrent", nonce="%s", opaque="opaque", qop="auth,auth-int", algorithm=MD5`, nonce))
+	return false
+}
+
+func TestAuth(t *testing.T) {
+	t.Run("basic", func(t *testing.T) {
+		srv := newAuthServer(t, basicAuthCheck)
+
+		result, err := NewClient(srv.URL, false, WithBasicAuth("user", "secret")).Call("d.name")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"called d.name"}, result)
+
+		_, err = NewClient(srv.URL, false, WithBasicAuth("user", "wrong")).Call("d.name")
+		require.Error(t, err)
+		var httpErr *HTTPError
+		require.True(t, errors.As(err, &httpErr), "unexpected error: %v", err)
+		require.Equal(t, http.StatusUnauthorized, httpErr.StatusCode)
+	})
+
+	t.Run("bearer", func(t *testing.T) {
+		srv := newAuthServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer token"
+		})
+
+		result, err := NewClient(srv.URL, false, WithBearerToken("token")).Call("d.name")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"called d.name"}, result)
+
+		_, err = NewClient(srv.URL, false).Call("d.name")
+		require.Error(t, err)
+	})
+
+	t.Run("digest", func(t *testing.T) {
+		digest := &digestAuthCheck{}
+		srv := newAuthServer(t, digest.check)
+		client := NewClient(srv.URL, false, WithDigestAuth("user", "secret"))
+
+		for i := 0; i < 3; i++ {
+			result, err := client.Call("d.name")
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{"called d.name"}, result)
+		}
+		require.Equal(t, 1, digest.challenges, "the challenge should be reused")
+		require.Equal(t, "00000003", digest.lastNC)
+
+		// rotate the nonce, the client has to retry with the stale challenge
+		digest.mu.Lock()
+		digest.nonce++
+		digest.mu.Unlock()
+		result, err := client.Call("d.name")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"called d.name"}, result)
+		require.Equal(t, 2, digest.challenges)
+		require.Equal(t, "00000001", digest.lastNC)
+
+		_, err = NewClient(srv.URL, false, WithDigestAuth("user", "wrong")).Call("d.name")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "401")
+	})
+
+	t.Run("credentials in address", func(t *testing.T) {
+		basic := newAuthServer(t, basicAuthCheck)
+		digest := newAuthServer(t, (&digestAuthCheck{}).check)
+
+		for _, srv := range []*httptest.Server{basic, digest} {
+			addr := strings.Replace(srv.URL, "http://", "http://user:secret@", 1)
+			result, err := NewClient(addr, false).Call("d.name")
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{"called d.name"}, result)
+		}
+
+		// an explicit option takes precedence
+		addr := strings.Replace(basic.URL, "http://", "http://user:wrong@", 1)
+		_, err := NewClient(addr, false, WithBasicAuth("user", "secret")).Call("d.name")
+		require.NoError(t, err)
+	})
+
+	t.Run("custom http client is not modified", func(t *testing.T) {
+		srv := newAuthServer(t, basicAuthCheck)
+		httpClient := &http.Client{}
+		_, err := NewClientWithHTTPClient(srv.URL, httpClient, WithBasicAuth("user", "secret")).Call("d.name")
+		require.NoError(t, err)
+		require.Nil(t, httpClient.Transport)
+	})
+}
+
+func TestParseAuthParams(t *testing.T) {
+	require.Equal(t, map[string]string{
+		"realm":     `a "quoted", realm`,
+		"nonce":     "abc",
+		"qop":       "auth,auth-int",
+		"algorithm": "MD5",
+	}, parseAuthParams(`realm="a \"quoted\", realm", nonce="abc",qop="auth,auth-int" , algorithm=MD5`))
+	require.Empty(t, parseAuthParams(""))
+}
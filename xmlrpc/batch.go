@@ -0,0 +1,141 @@
+package xmlrpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Batch collects calls which are sent to the server in a single system.multicall request.
+// Each call succeeds or fails on its own, a fault in one call does not affect the others.
+//
+// Example:
+//  results, err := client.NewBatch().
+//  	Add("d.name", hash).
+//  	Add("d.size_bytes", hash).
+//  	Run()
+type Batch struct {
+	client *Client
+	calls  []batchCall
+}
+
+type batchCall struct {
+	name string
+	args []interface{}
+}
+
+// BatchResult is the outcome of a single call within a Batch
+type BatchResult struct {
+	// Method is the name of the method which was called
+	Method string
+	// Value is the result of the call, nil if the call failed
+	Value interface{}
+	// Err is the *Fault reported by the server for this call, nil if the call succeeded
+	Err error
+}
+
+var batchResultsType = reflect.TypeOf([]BatchResult{})
+
+// NewBatch returns a new, empty Batch which runs its calls with this Client
+func (c *Client) NewBatch() *Batch {
+	return &Batch{client: c}
+}
+
+// Add queues a call of the method with "name" with the given args and returns the Batch for chaining
+func (b *Batch) Add(name string, args ...interface{}) *Batch {
+	if args == nil {
+		args = []interface{}{}
+	}
+	b.calls = append(b.calls, batchCall{name: name, args: args})
+	return b
+}
+
+// Len returns the number of calls queued in the Batch
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// Run sends all queued calls in a single system.multicall request
+// Returns one result per call, in the order the calls were added, and an error for communication errors
+func (b *Batch) Run() ([]BatchResult, error) {
+	return b.RunContext(context.Background())
+}
+
+// RunContext is like Run but takes a context which controls cancellation and deadlines
+func (b *Batch) RunContext(ctx context.Context) ([]BatchResult, error) {
+	if len(b.calls) == 0 {
+		return nil, nil
+	}
+
+	calls := make([]interface{}, len(b.calls))
+	for i, call := range b.calls {
+		calls[i] = map[string]interface{}{
+			"methodName": call.name,
+			"params":     call.args,
+		}
+	}
+
+	result, err := b.client.CallContext(ctx, "system.multicall", calls)
+	if err != nil {
+		return nil, err
+	}
+	return b.results(result)
+}
+
+// results matches the system.multicall response against the queued calls.
+// Successful calls are returned as a single element array, faults as a faultCode/faultString struct.
+// A response which does not fit the queued calls is reported as a *DecodeError.
+func (b *Batch) results(result interface{}) ([]BatchResult, error) {
+	invalid := func(path string, v interface{}, format string, args ...interface{}) error {
+		return &DecodeError{Path: path, Value: v, Type: batchResultsType, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	params, ok := result.([]interface{})
+	if !ok || len(params) != 1 {
+		return nil, invalid("", result, "expected a single param")
+	}
+	values, ok := params[0].([]interface{})
+	if !ok {
+		return nil, invalid("[0]", params[0], "expected an array")
+	}
+	if len(values) != len(b.calls) {
+		return nil, invalid("[0]", values, "system.multicall returned %d results for %d calls", len(values), len(b.calls))
+	}
+
+	results := make([]BatchResult, len(values))
+	for i, v := range values {
+		path := fmt.Sprintf("[0][%d]", i)
+		results[i].Method = b.calls[i].name
+		switch value := v.(type) {
+		case []interface{}:
+			if len(value) != 1 {
+				return nil, invalid(path, v, "expected a single value for %s", b.calls[i].name)
+			}
+			results[i].Value = value[0]
+		case map[string]interface{}:
+			fault, err := faultFromStruct(value)
+			if err != nil {
+				return nil, invalid(path, v, "invalid fault for %s: %v", b.calls[i].name, err)
+			}
+			results[i].Err = fault
+		default:
+			return nil, invalid(path, v, "expected an array or fault for %s", b.calls[i].name)
+		}
+	}
+	return results, nil
+}
+
+// faultFromStruct converts a faultCode/faultString struct into a Fault
+func faultFromStruct(v map[string]interface{}) (*Fault, error) {
+	code, ok := asInt64(v["faultCode"])
+	if !ok {
+		return nil, errors.Errorf("faultCode not int: %v", v["faultCode"])
+	}
+	msg, ok := v["faultString"].(string)
+	if !ok {
+		return nil, errors.Errorf("faultString not string: %v", v["faultString"])
+	}
+	return &Fault{Code: int(code), Message: msg}, nil
+}
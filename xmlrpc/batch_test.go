@@ -0,0 +1,77 @@
+package xmlrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	var requests int
+	srv := newTestServer(t, func(name string, params []interface{}) interface{} {
+		requests++
+		require.Equal(t, "system.multicall", name)
+		require.Len(t, params, 1)
+
+		var results []interface{}
+		for _, call := range params[0].([]interface{}) {
+			c := call.(map[string]interface{})
+			args := c["params"].([]interface{})
+			switch c["methodName"] {
+			case "d.name":
+				results = append(results, []interface{}{"name-of-" + args[0].(string)})
+			case "d.size_bytes":
+				results = append(results, []interface{}{1234})
+			default:
+				results = append(results, map[string]interface{}{
+					"faultCode":   -506,
+					"faultString": "Method '" + c["methodName"].(string) + "' not defined",
+				})
+			}
+		}
+		return results
+	})
+	client := NewClient(srv.URL, false)
+
+	t.Run("mixed results", func(t *testing.T) {
+		requests = 0
+		results, err := client.NewBatch().
+			Add("d.name", "ABC").
+			Add("d.bogus", "ABC").
+			Add("d.size_bytes", "ABC").
+			Run()
+		require.NoError(t, err)
+		require.Equal(t, 1, requests)
+		require.Len(t, results, 3)
+
+		require.Equal(t, "d.name", results[0].Method)
+		require.NoError(t, results[0].Err)
+		require.Equal(t, "name-of-ABC", results[0].Value)
+
+		require.Equal(t, "d.bogus", results[1].Method)
+		require.Nil(t, results[1].Value)
+		require.Equal(t, &Fault{Code: -506, Message: "Method 'd.bogus' not defined"}, results[1].Err)
+
+		require.NoError(t, results[2].Err)
+		require.Equal(t, 1234, results[2].Value)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		requests = 0
+		batch := client.NewBatch()
+		require.Zero(t, batch.Len())
+		results, err := batch.Run()
+		require.NoError(t, err)
+		require.Empty(t, results)
+		require.Zero(t, requests)
+	})
+
+	t.Run("result count mismatch", func(t *testing.T) {
+		srv := newTestServer(t, func(name string, params []interface{}) interface{} {
+			return []interface{}{}
+		})
+		_, err := NewClient(srv.URL, false).NewBatch().Add("d.name", "ABC").Run()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "returned 0 results for 1 calls")
+	})
+}
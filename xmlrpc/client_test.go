@@ -1,3 +1,161 @@
 package xmlrpc
 
-// TODO: add tests
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer starts an httptest server which answers every call with the result of handler
+func newTestServer(t *testing.T, handler func(name string, params []interface{}) interface{}) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, params, _, err := Unmarshal(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "text/xml")
+		require.NoError(t, Marshal(w, "", handler(name, params)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCallContext(t *testing.T) {
+	t.Run("http", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer srv.Close()
+		defer close(release)
+
+		client := NewClient(srv.URL, false)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := client.CallContext(ctx, "d.name", "hash")
+		require.Error(t, err)
+		require.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	})
+
+	t.Run("scgi", func(t *testing.T) {
+		// Accept connections but never answer, like a busy rTorrent
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		client := NewClient("scgi://"+l.Addr().String(), false)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-time.After(50 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err = client.CallContext(ctx, "d.name", "hash")
+		require.Error(t, err)
+		require.True(t, errors.Is(err, context.Canceled), "unexpected error: %v", err)
+	})
+}
+
+func TestCallFault(t *testing.T) {
+	srv := newTestServer(t, func(name string, params []interface{}) interface{} {
+		return Fault{Code: -501, Message: "Could not find info-hash."}
+	})
+
+	_, err := NewClient(srv.URL, false).Call("d.name", "hash")
+	require.Error(t, err)
+	var fault *Fault
+	require.True(t, errors.As(err, &fault), "unexpected error type %T: %v", err, err)
+	require.Equal(t, -501, fault.Code)
+	require.Equal(t, "Could not find info-hash.", fault.Message)
+
+	// wrapping keeps the fault accessible
+	err = errors.Wrap(err, "d.name XMLRPC call failed")
+	fault = nil
+	require.True(t, errors.As(err, &fault))
+	require.Equal(t, -501, fault.Code)
+}
+
+func TestCallHTTPErrors(t *testing.T) {
+	respond := func(status int, contentType, body string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			} else {
+				// prevent content sniffing
+				w.Header()["Content-Type"] = nil
+			}
+			w.Header().Set("X-Test", "yes")
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		addr := respond(http.StatusUnauthorized, "text/html", "<html>401 Authorization Required</html>")
+		_, err := NewClient(addr, false).Call("d.name", "hash")
+		require.Error(t, err)
+		var httpErr *HTTPError
+		require.True(t, errors.As(err, &httpErr), "unexpected error type %T: %v", err, err)
+		require.Equal(t, http.StatusUnauthorized, httpErr.StatusCode)
+		require.Equal(t, "401 Unauthorized", httpErr.Status)
+		require.Equal(t, "yes", httpErr.Header.Get("X-Test"))
+		require.Equal(t, "<html>401 Authorization Required</html>", httpErr.Body)
+		require.Contains(t, err.Error(), "unexpected HTTP status 401 Unauthorized")
+	})
+
+	t.Run("bad gateway with large body", func(t *testing.T) {
+		addr := respond(http.StatusBadGateway, "text/html", strings.Repeat("x", 10000))
+		_, err := NewClient(addr, false).Call("d.name", "hash")
+		var httpErr *HTTPError
+		require.True(t, errors.As(err, &httpErr), "unexpected error type %T: %v", err, err)
+		require.Equal(t, http.StatusBadGateway, httpErr.StatusCode)
+		require.Len(t, httpErr.Body, maxErrorBody+len("..."))
+	})
+
+	t.Run("html content", func(t *testing.T) {
+		addr := respond(http.StatusOK, "text/html; charset=utf-8", "<html><body>Login</body></html>")
+		_, err := NewClient(addr, false).Call("d.name", "hash")
+		var ctErr *ContentTypeError
+		require.True(t, errors.As(err, &ctErr), "unexpected error type %T: %v", err, err)
+		require.Equal(t, "text/html; charset=utf-8", ctErr.ContentType)
+		require.Equal(t, "<html><body>Login</body></html>", ctErr.Body)
+	})
+
+	t.Run("content types merely containing xml", func(t *testing.T) {
+		body := "<methodResponse><params><param><value><string>ok</string></value></param></params></methodResponse>"
+		for _, ct := range []string{"application/xhtml+xml", "text/xml-external-parsed-entity", "application/xmlx"} {
+			addr := respond(http.StatusOK, ct, body)
+			_, err := NewClient(addr, false).Call("d.name", "hash")
+			var ctErr *ContentTypeError
+			require.True(t, errors.As(err, &ctErr), "unexpected error for %s: %v", ct, err)
+		}
+	})
+
+	t.Run("xml content types", func(t *testing.T) {
+		body := "<methodResponse><params><param><value><string>ok</string></value></param></params></methodResponse>"
+		for _, ct := range []string{"text/xml", "application/xml; charset=utf-8", "application/xmlrpc+xml", ""} {
+			addr := respond(http.StatusOK, ct, body)
+			result, err := NewClient(addr, false).Call("d.name", "hash")
+			require.NoError(t, err, ct)
+			require.Equal(t, []interface{}{"ok"}, result)
+		}
+	})
+}
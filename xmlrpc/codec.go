@@ -0,0 +1,159 @@
+package xmlrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Codec encodes the requests and decodes the responses of a Client.
+// Results of all codecs have the same shape: the params of the response,
+// with integers decoded as int, or int64 for i8 and values beyond 32 bits, floats as float64,
+// arrays as []interface{} and structs as map[string]interface{}.
+type Codec interface {
+	// ContentType is sent as the Content-Type of requests.
+	// Responses are expected to carry a media type with its subtype, e.g. "xml" for "text/xml" or "application/rss+xml".
+	ContentType() string
+	// EncodeRequest writes a call of method with args to w
+	EncodeRequest(w io.Writer, method string, args []interface{}) error
+	// DecodeResponse reads the params of a response from r, a fault is returned as a *Fault error
+	DecodeResponse(r io.Reader) ([]interface{}, error)
+}
+
+// XMLCodec encodes calls as XML-RPC, it is the default codec of a Client
+var XMLCodec Codec = xmlCodec{}
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string {
+	return "text/xml"
+}
+
+func (xmlCodec) EncodeRequest(w io.Writer, method string, args []interface{}) error {
+	return Marshal(w, method, args...)
+}
+
+func (c xmlCodec) DecodeResponse(r io.Reader) ([]interface{}, error) {
+	return c.decodeResponse(r, DefaultLimits, nil)
+}
+
+func (xmlCodec) decodeResponse(r io.Reader, limits Limits, _ json.RawMessage) ([]interface{}, error) {
+	_, params, fault, err := UnmarshalLimits(r, limits)
+	if fault != nil {
+		return nil, fault
+	}
+	return params, err
+}
+
+// limitedCodec is implemented by the codecs of this package, which enforce Limits while decoding.
+// JSON-RPC responses are checked to answer the request with id, unless it is nil.
+type limitedCodec interface {
+	decodeResponse(r io.Reader, limits Limits, id json.RawMessage) ([]interface{}, error)
+	decodeResponseEach(r io.Reader, limits Limits, id json.RawMessage, fn func(elem interface{}) error) error
+}
+
+// decodeResponse decodes a response with codec, enforcing limits
+func decodeResponse(codec Codec, r io.Reader, limits Limits, id json.RawMessage) ([]interface{}, error) {
+	if codec, ok := codec.(limitedCodec); ok {
+		return codec.decodeResponse(r, limits, id)
+	}
+	params, err := codec.DecodeResponse(limitReader(r, limits.MaxResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.checkParams(params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// WithCodec sets the codec used to encode calls, e.g. JSONCodec for rTorrent 0.15 and newer
+func WithCodec(codec Codec) Option {
+	return func(c *Client) {
+		c.codec, c.autoCodec = codec, false
+	}
+}
+
+// WithNilExtension encodes nil pointers and interfaces in the args of calls as <nil/>,
+// for servers which support the Apache XMLRPC extensions. JSONCodec always encodes them as null.
+func WithNilExtension() Option {
+	return func(c *Client) {
+		c.encoder.Nil = true
+	}
+}
+
+// encodeRequest encodes a call with codec, using the encoder of the client for XMLCodec
+// The id of JSON-RPC requests is returned, so the response can be checked to answer it.
+func (c *Client) encodeRequest(w io.Writer, codec Codec, name string, args []interface{}) (json.RawMessage, error) {
+	switch codec := codec.(type) {
+	case xmlCodec:
+		return nil, c.encoder.Marshal(w, name, args...)
+	case *jsonCodec:
+		id := codec.nextID()
+		return id, codec.encodeRequest(w, name, args, id)
+	}
+	return nil, codec.EncodeRequest(w, name, args)
+}
+
+// WithAutoCodec detects the codec to use with the first call:
+// a JSON-RPC probe is sent, and XMLCodec is used if the server does not answer it with JSON.
+// Errors which do not tell anything about the server, e.g. refused connections, are returned
+// from the call and the detection is repeated with the next call.
+func WithAutoCodec() Option {
+	return func(c *Client) {
+		c.codec, c.autoCodec = nil, true
+	}
+}
+
+// codecSubtype returns the part of the codec's content type used to recognize responses, e.g. "xml" or "json"
+func codecSubtype(codec Codec) string {
+	contentType := codec.ContentType()
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.TrimSpace(contentType[strings.LastIndexByte(contentType, '/')+1:])
+}
+
+// resolveCodec returns the codec of the client, detecting it first if necessary
+func (c *Client) resolveCodec(ctx context.Context) (Codec, error) {
+	if !c.autoCodec {
+		return c.codec, nil
+	}
+	c.codecMu.Lock()
+	defer c.codecMu.Unlock()
+	if c.codec != nil {
+		return c.codec, nil
+	}
+	codec, err := c.detectCodec(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to detect codec")
+	}
+	c.codec = codec
+	return codec, nil
+}
+
+// detectCodec probes the server with a JSON-RPC call of system.client_version
+func (c *Client) detectCodec(ctx context.Context) (Codec, error) {
+	_, err := c.roundTrip(ctx, JSONCodec, "system.client_version", nil)
+	var fault *Fault
+	var httpErr *HTTPError
+	var netErr net.Error
+	switch {
+	case err == nil || errors.As(err, &fault):
+		// a JSON-RPC answer, even an error, means the server speaks JSON-RPC
+		return JSONCodec, nil
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr):
+		return nil, err
+	case errors.As(err, &httpErr) &&
+		(httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden):
+		return nil, err
+	default:
+		// anything else, e.g. an XML fault or a rejected content type, means the server only speaks XML-RPC
+		return XMLCodec, nil
+	}
+}
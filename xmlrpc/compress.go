@@ -0,0 +1,168 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// gzipMinSize is the size from which Server compresses responses, smaller ones hardly shrink
+const gzipMinSize = 1024
+
+// WithRequestCompression gzips request bodies of at least minSize bytes, e.g. load.raw with big .torrent files.
+// Requests are only compressed once the server advertised support for gzip encoded requests
+// with an Accept-Encoding response header (RFC 7694), as Server does. A server rejecting a compressed request
+// with 415 Unsupported Media Type gets it again uncompressed, and no further compressed requests.
+//
+// Responses are decompressed regardless of this option, the client always accepts gzip encoded responses.
+func WithRequestCompression(minSize int) Option {
+	return func(c *Client) {
+		c.compressMin = minSize
+	}
+}
+
+// compressRequest returns the body of a request gzipped, if it should be compressed
+func (c *Client) compressRequest(body []byte) ([]byte, bool) {
+	if c.compressMin <= 0 || len(body) < c.compressMin || atomic.LoadInt32(&c.serverGzip) != gzipAccepted {
+		return body, false
+	}
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(body); err != nil {
+		return body, false
+	}
+	if err := zw.Close(); err != nil {
+		return body, false
+	}
+	return b.Bytes(), true
+}
+
+// states of Client.serverGzip
+const (
+	gzipUnknown int32 = iota
+	gzipAccepted
+	gzipRejected
+)
+
+// noteRequestEncodings remembers whether the server accepts gzip encoded requests, as told by its response,
+// unless it rejected a compressed request before
+func (c *Client) noteRequestEncodings(resp *http.Response) {
+	values, ok := resp.Header["Accept-Encoding"]
+	if !ok {
+		return
+	}
+	state := gzipUnknown
+	if acceptsGzip(strings.Join(values, ",")) {
+		state = gzipAccepted
+	}
+	for {
+		old := atomic.LoadInt32(&c.serverGzip)
+		if old == gzipRejected || atomic.CompareAndSwapInt32(&c.serverGzip, old, state) {
+			return
+		}
+	}
+}
+
+// decompressResponse replaces the body of a gzip encoded response with its decompressed content
+func decompressResponse(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+	default:
+		return errors.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress response")
+	}
+	resp.Body = &gzipReadCloser{Reader: zr, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.body.Close()
+}
+
+// acceptsGzip tells whether an Accept-Encoding header accepts gzip
+func acceptsGzip(header string) bool {
+	for _, coding := range strings.Split(header, ",") {
+		params := strings.Split(coding, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name != "gzip" && name != "x-gzip" && name != "*" {
+			continue
+		}
+		rejected := false
+		for _, param := range params[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) == 2 && strings.TrimSpace(kv[0]) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+				rejected = err == nil && q == 0
+			}
+		}
+		if !rejected {
+			return true
+		}
+	}
+	return false
+}
+
+// requestBody returns the decompressed body of a request to a Server.
+// An error is only returned for an unsupported encoding, a corrupt body fails when it is read.
+func requestBody(r *http.Request) (io.Reader, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return errReader{errors.Wrap(err, "failed to decompress request")}, nil
+		}
+		return zr, nil
+	default:
+		return nil, errors.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+}
+
+// errReader fails every read with err
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// writeResponse writes the response of a Server, gzipped if the client accepts it and it is large enough to benefit
+func writeResponse(w http.ResponseWriter, r *http.Request, contentType string, b *bytes.Buffer) {
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	// tell clients that requests may be compressed, see RFC 7694
+	h.Set("Accept-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	if b.Len() < gzipMinSize || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		b.WriteTo(w)
+		return
+	}
+	h.Set("Content-Encoding", "gzip")
+	zw := gzip.NewWriter(w)
+	b.WriteTo(zw)
+	zw.Close()
+}
@@ -0,0 +1,251 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return b.Bytes()
+}
+
+// encodingRecorder records the Content-Encoding of the requests to a handler
+type encodingRecorder struct {
+	http.Handler
+	mu        sync.Mutex
+	encodings []string
+}
+
+func (h *encodingRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.encodings = append(h.encodings, r.Header.Get("Content-Encoding"))
+	h.mu.Unlock()
+	h.Handler.ServeHTTP(w, r)
+}
+
+func (h *encodingRecorder) last() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.encodings[len(h.encodings)-1]
+}
+
+func TestResponseCompression(t *testing.T) {
+	rows := make([]interface{}, 100)
+	for i := range rows {
+		rows[i] = []interface{}{"Some.Linux.Distribution.iso", 1 << 30, "/downloads/temp"}
+	}
+	var xmlBody bytes.Buffer
+	require.NoError(t, Marshal(&xmlBody, "", rows))
+	// a server like a reverse proxy in front of rTorrent, which compresses every response
+	var result interface{}
+	var err error
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, contentType := xmlBody.Bytes(), "text/xml"
+		if strings.Contains(r.Header.Get("Content-Type"), "json") {
+			var req jsonRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			jsonBody, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": rows})
+			require.NoError(t, err)
+			body, contentType = jsonBody, "application/json"
+		}
+		w.Header().Set("Content-Type", contentType)
+		if r.Header.Get("Accept-Encoding") == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			body = gzipped(t, body)
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	for _, codec := range []Codec{XMLCodec, JSONCodec} {
+		client := NewClient(ts.URL, false, WithCodec(codec))
+		result, err = client.Call("d.multicall2", "", "main")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{rows}, result)
+
+		var elems []interface{}
+		require.NoError(t, client.CallEach(context.Background(), "d.multicall2", []interface{}{"", "main"}, collect(&elems)))
+		require.Equal(t, rows, elems)
+
+		// the limit applies to the decompressed response, which protects against gzip bombs
+		_, err = NewClient(ts.URL, false, WithCodec(codec), WithLimits(Limits{MaxResponseBytes: 1024})).Call("d.multicall2", "", "main")
+		var limitErr *LimitError
+		require.True(t, errors.As(err, &limitErr), "unexpected error: %v", err)
+	}
+
+	// transports other than http.Transport, e.g. SCGI, don't decompress on their own
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		require.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/xml"}, "Content-Encoding": {"gzip"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(gzipped(t, xmlBody.Bytes()))),
+		}, nil
+	})
+	result, err = NewClientWithHTTPClient("http://rtorrent/RPC2", &http.Client{Transport: transport}).Call("d.multicall2", "", "main")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{rows}, result)
+
+	transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/xml"}, "Content-Encoding": {"br"}},
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+	_, err = NewClientWithHTTPClient("http://rtorrent/RPC2", &http.Client{Transport: transport}).Call("d.name", "ABC")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported Content-Encoding")
+}
+
+func TestRequestCompression(t *testing.T) {
+	srv := newCodecTestServer(t)
+	require.NoError(t, srv.Register("d.custom.set", func(hash, key, value string) int {
+		return len(value)
+	}))
+	recorder := &encodingRecorder{Handler: srv}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+	value := strings.Repeat("label", 1000)
+
+	for _, codec := range []Codec{XMLCodec, JSONCodec} {
+		client := NewClient(ts.URL, false, WithCodec(codec), WithRequestCompression(1024))
+
+		// the server has not advertised gzip support yet
+		result, err := client.Call("d.custom.set", "ABC", "key", value)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{len(value)}, result)
+		require.Empty(t, recorder.last())
+
+		result, err = client.Call("d.custom.set", "ABC", "key", value)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{len(value)}, result)
+		require.Equal(t, "gzip", recorder.last())
+
+		// small requests are sent as is
+		_, err = client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		require.Empty(t, recorder.last())
+
+		// without the option requests are never compressed
+		client = NewClient(ts.URL, false, WithCodec(codec))
+		for i := 0; i < 2; i++ {
+			_, err = client.Call("d.custom.set", "ABC", "key", value)
+			require.NoError(t, err)
+			require.Empty(t, recorder.last())
+		}
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		// advertises gzip support but rejects compressed requests
+		var encodings []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encodings = append(encodings, r.Header.Get("Content-Encoding"))
+			w.Header().Set("Accept-Encoding", "gzip")
+			if r.Header.Get("Content-Encoding") != "" {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			srv.ServeHTTP(w, r)
+		}))
+		defer ts.Close()
+
+		client := NewClient(ts.URL, false, WithRequestCompression(1))
+		for i := 0; i < 3; i++ {
+			_, err := client.Call("d.name", "ABC")
+			require.NoError(t, err)
+		}
+		require.Equal(t, []string{"", "gzip", "", ""}, encodings)
+	})
+}
+
+func TestServerCompression(t *testing.T) {
+	ts := httptest.NewServer(newCodecTestServer(t))
+	defer ts.Close()
+	// a transport which leaves compressed responses alone
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	post := func(body []byte, header http.Header) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header = header
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	var call bytes.Buffer
+	require.NoError(t, Marshal(&call, "system.listMethods"))
+
+	resp := post(gzipped(t, call.Bytes()), http.Header{"Content-Type": {"text/xml"}, "Content-Encoding": {"gzip"}})
+	defer resp.Body.Close()
+	require.Equal(t, "gzip", resp.Header.Get("Accept-Encoding"))
+	require.Empty(t, resp.Header.Get("Content-Encoding"))
+	_, params, fault, err := Unmarshal(resp.Body)
+	require.NoError(t, err)
+	require.Nil(t, fault)
+	require.Contains(t, params[0], "system.listMethods")
+
+	resp = post(call.Bytes(), http.Header{"Content-Type": {"text/xml"}, "Content-Encoding": {"br"}})
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	require.Equal(t, "gzip", resp.Header.Get("Accept-Encoding"))
+
+	resp = post(call.Bytes(), http.Header{"Content-Type": {"text/xml"}, "Content-Encoding": {"gzip"}})
+	_, _, fault, err = Unmarshal(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, FaultParseError, fault.Code)
+
+	// large responses are compressed for clients which accept it
+	var multicall bytes.Buffer
+	calls := make([]interface{}, 50)
+	for i := range calls {
+		calls[i] = map[string]interface{}{"methodName": "system.listMethods", "params": []interface{}{}}
+	}
+	require.NoError(t, Marshal(&multicall, "system.multicall", calls))
+	resp = post(multicall.Bytes(), http.Header{"Content-Type": {"text/xml"}, "Accept-Encoding": {"gzip"}})
+	defer resp.Body.Close()
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	_, params, _, err = Unmarshal(zr)
+	require.NoError(t, err)
+	require.Len(t, params[0], 50)
+
+	resp = post(multicall.Bytes(), http.Header{"Content-Type": {"text/xml"}, "Accept-Encoding": {"gzip;q=0"}})
+	defer resp.Body.Close()
+	require.Empty(t, resp.Header.Get("Content-Encoding"))
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                       false,
+		"gzip":                   true,
+		"GZIP":                   true,
+		"deflate, gzip;q=1.0":    true,
+		"br;q=1.0, gzip; q=0.5":  true,
+		"gzip;q=0":               false,
+		"gzip;q=0.000, identity": false,
+		"*":                      true,
+		"identity, x-gzip":       true,
+		"deflate, br":            false,
+	} {
+		require.Equal(t, want, acceptsGzip(header), header)
+	}
+}
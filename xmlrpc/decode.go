@@ -0,0 +1,262 @@
+package xmlrpc
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DecodeError describes a value which could not be decoded into a Go value of the requested type
+type DecodeError struct {
+	// Path locates the value within the decoded result, e.g. "[0][2]" or ".faultCode"
+	Path string
+	// Value is the XML-RPC value which could not be decoded
+	Value interface{}
+	// Type is the Go type the value should have been decoded into
+	Type reflect.Type
+	// Reason explains why the value could not be decoded, if there is more to say than a type mismatch
+	Reason string
+}
+
+func (e *DecodeError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "result"
+	}
+	msg := fmt.Sprintf("xmlrpc: cannot decode %T %v into %v at %s", e.Value, e.Value, e.Type, path)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Decode stores the XML-RPC value v, as returned by Call or Unmarshal, into the value pointed to by target.
+//
+// Arrays decode into slices and arrays, structs decode into maps and Go structs.
+// Struct members are matched against the `xmlrpc:"name"` tag of a field or, without a tag, its name.
+// Arrays decode into Go structs positionally, element i is stored in the i-th exported field
+// not tagged with `xmlrpc:"-"`, which fits the rows returned by d.multicall2 and friends.
+// Integers decode into any integer, float or bool kind (non-zero is true) and into time.Time as Unix seconds.
+//
+// A *DecodeError is returned when the value does not fit the target, Decode never panics on unexpected values.
+func Decode(v interface{}, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &DecodeError{Value: v, Type: reflect.TypeOf(target), Reason: "target must be a non-nil pointer"}
+	}
+	return decodeValue("", v, rv.Elem())
+}
+
+// asInt64 returns the value of a decoded integer, which is an int or, for i8 and values beyond 32 bits, an int64
+func asInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+func decodeValue(path string, v interface{}, dst reflect.Value) error {
+	mismatch := func() error {
+		return &DecodeError{Path: path, Value: v, Type: dst.Type()}
+	}
+
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		if v == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(reflect.ValueOf(v))
+		}
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		if v == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(path, v, dst.Elem())
+	}
+	if dst.Type() == timeType {
+		switch value := v.(type) {
+		case time.Time:
+			dst.Set(reflect.ValueOf(value))
+			return nil
+		}
+		if value, ok := asInt64(v); ok {
+			dst.Set(reflect.ValueOf(time.Unix(value, 0)))
+			return nil
+		}
+		return mismatch()
+	}
+
+	switch dst.Kind() {
+	case reflect.Bool:
+		if value, ok := v.(bool); ok {
+			dst.SetBool(value)
+		} else if value, ok := asInt64(v); ok {
+			dst.SetBool(value != 0)
+		} else {
+			return mismatch()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, ok := asInt64(v)
+		if !ok {
+			return mismatch()
+		}
+		if dst.OverflowInt(value) {
+			return &DecodeError{Path: path, Value: v, Type: dst.Type(), Reason: "value overflows type"}
+		}
+		dst.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, ok := asInt64(v)
+		if !ok {
+			return mismatch()
+		}
+		if value < 0 || dst.OverflowUint(uint64(value)) {
+			return &DecodeError{Path: path, Value: v, Type: dst.Type(), Reason: "value overflows type"}
+		}
+		dst.SetUint(uint64(value))
+	case reflect.Float32, reflect.Float64:
+		if value, ok := v.(float64); ok {
+			if dst.Kind() == reflect.Float32 && math.Abs(value) > math.MaxFloat32 {
+				return &DecodeError{Path: path, Value: v, Type: dst.Type(), Reason: "value overflows type"}
+			}
+			dst.SetFloat(value)
+		} else if value, ok := asInt64(v); ok {
+			dst.SetFloat(float64(value))
+		} else {
+			return mismatch()
+		}
+	case reflect.String:
+		value, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetString(value)
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			switch value := v.(type) {
+			case []byte:
+				dst.SetBytes(value)
+				return nil
+			case string:
+				dst.SetBytes([]byte(value))
+				return nil
+			}
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(values), len(values))
+		for i, elem := range values {
+			if err := decodeValue(fmt.Sprintf("%s[%d]", path, i), elem, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+	case reflect.Array:
+		values, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		if len(values) != dst.Len() {
+			return &DecodeError{Path: path, Value: v, Type: dst.Type(), Reason: fmt.Sprintf("expected %d elements, got %d", dst.Len(), len(values))}
+		}
+		for i, elem := range values {
+			if err := decodeValue(fmt.Sprintf("%s[%d]", path, i), elem, dst.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		members, ok := v.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(members))
+		for name, member := range members {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeValue(path+"."+name, member, elem); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(name).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		switch value := v.(type) {
+		case map[string]interface{}:
+			return decodeStruct(path, value, dst)
+		case []interface{}:
+			return decodePositional(path, value, dst)
+		}
+		return mismatch()
+	default:
+		return &DecodeError{Path: path, Value: v, Type: dst.Type(), Reason: "unsupported target type"}
+	}
+	return nil
+}
+
+// decodeFields returns the indexes of the fields of t which take part in decoding, with their member names
+func decodeFields(t reflect.Type) (indexes []int, names []string) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("xmlrpc"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		indexes = append(indexes, i)
+		names = append(names, name)
+	}
+	return
+}
+
+func decodeStruct(path string, members map[string]interface{}, dst reflect.Value) error {
+	indexes, names := decodeFields(dst.Type())
+	for i, index := range indexes {
+		member, ok := members[names[i]]
+		if !ok {
+			// fall back to a case insensitive match, like encoding/json
+			for name, m := range members {
+				if strings.EqualFold(name, names[i]) {
+					member, ok = m, true
+					break
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := decodeValue(path+"."+names[i], member, dst.Field(index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodePositional(path string, values []interface{}, dst reflect.Value) error {
+	indexes, _ := decodeFields(dst.Type())
+	if len(values) != len(indexes) {
+		return &DecodeError{Path: path, Value: values, Type: dst.Type(), Reason: fmt.Sprintf("expected %d elements, got %d", len(indexes), len(values))}
+	}
+	for i, index := range indexes {
+		if err := decodeValue(fmt.Sprintf("%s[%d]", path, i), values[i], dst.Field(index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
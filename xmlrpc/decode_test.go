@@ -0,0 +1,157 @@
+package xmlrpc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	t.Run("scalars", func(t *testing.T) {
+		var s string
+		require.NoError(t, Decode("name", &s))
+		require.Equal(t, "name", s)
+
+		var i64 int64
+		require.NoError(t, Decode(1437206706, &i64))
+		require.Equal(t, int64(1437206706), i64)
+
+		var u8 uint8
+		require.NoError(t, Decode(200, &u8))
+		require.Equal(t, uint8(200), u8)
+
+		var b bool
+		require.NoError(t, Decode(1, &b))
+		require.True(t, b)
+		require.NoError(t, Decode(false, &b))
+		require.False(t, b)
+
+		var f float64
+		require.NoError(t, Decode(3, &f))
+		require.Equal(t, float64(3), f)
+
+		var ts time.Time
+		require.NoError(t, Decode(1636000000, &ts))
+		require.Equal(t, time.Unix(1636000000, 0), ts)
+
+		var raw []byte
+		require.NoError(t, Decode([]byte("data"), &raw))
+		require.Equal(t, []byte("data"), raw)
+
+		var value interface{}
+		require.NoError(t, Decode([]interface{}{1, "a"}, &value))
+		require.Equal(t, []interface{}{1, "a"}, value)
+
+		var p *string
+		require.NoError(t, Decode("pointer", &p))
+		require.Equal(t, "pointer", *p)
+	})
+
+	t.Run("int64", func(t *testing.T) {
+		var i64 int64
+		require.NoError(t, Decode(int64(1)<<53+1, &i64))
+		require.Equal(t, int64(1)<<53+1, i64)
+
+		var u64 uint64
+		require.NoError(t, Decode(int64(1)<<40, &u64))
+		require.Equal(t, uint64(1)<<40, u64)
+
+		var i32 int32
+		require.NoError(t, Decode(int64(5), &i32))
+		require.Equal(t, int32(5), i32)
+		err := Decode(int64(1)<<31, &i32)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "overflows")
+
+		var b bool
+		require.NoError(t, Decode(int64(1), &b))
+		require.True(t, b)
+
+		var f float64
+		require.NoError(t, Decode(int64(1)<<40, &f))
+		require.Equal(t, float64(1<<40), f)
+
+		var ts time.Time
+		require.NoError(t, Decode(int64(4102444800), &ts))
+		require.Equal(t, time.Unix(4102444800, 0), ts)
+	})
+
+	t.Run("slices and positional structs", func(t *testing.T) {
+		type row struct {
+			Name    string
+			Size    int
+			skipped int
+			Ignored string `xmlrpc:"-"`
+			Active  bool
+		}
+		var rows []row
+		err := Decode([]interface{}{
+			[]interface{}{"a", 1, 0},
+			[]interface{}{"b", 2, 1},
+		}, &rows)
+		require.NoError(t, err)
+		require.Equal(t, []row{{Name: "a", Size: 1}, {Name: "b", Size: 2, Active: true}}, rows)
+
+		var pair [2]int
+		require.NoError(t, Decode([]interface{}{1, 2}, &pair))
+		require.Equal(t, [2]int{1, 2}, pair)
+	})
+
+	t.Run("structs and maps", func(t *testing.T) {
+		var fault struct {
+			Code    int    `xmlrpc:"faultCode"`
+			Message string `xmlrpc:"faultString"`
+			Other   string
+		}
+		err := Decode(map[string]interface{}{
+			"faultCode":   -501,
+			"faultString": "Could not find info-hash.",
+			"other":       "case insensitive",
+		}, &fault)
+		require.NoError(t, err)
+		require.Equal(t, -501, fault.Code)
+		require.Equal(t, "Could not find info-hash.", fault.Message)
+		require.Equal(t, "case insensitive", fault.Other)
+
+		var m map[string]int
+		require.NoError(t, Decode(map[string]interface{}{"a": 1, "b": 2}, &m))
+		require.Equal(t, map[string]int{"a": 1, "b": 2}, m)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var rows []struct {
+			Name string
+			Size int
+		}
+		err := Decode([]interface{}{[]interface{}{"a", 1}, []interface{}{"b", "2"}}, &rows)
+		require.Error(t, err)
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		require.Equal(t, "[1][1]", decodeErr.Path)
+		require.Equal(t, "2", decodeErr.Value)
+		require.Contains(t, err.Error(), "cannot decode string 2 into int at [1][1]")
+
+		err = Decode([]interface{}{[]interface{}{"a"}}, &rows)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "expected 2 elements, got 1")
+
+		var i8 int8
+		err = Decode(300, &i8)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "overflows")
+
+		var u uint
+		require.Error(t, Decode(-1, &u))
+
+		var s string
+		require.Error(t, Decode(nil, &s))
+		require.Error(t, Decode([]interface{}{}, &s))
+
+		err = Decode("value", s)
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "non-nil pointer"))
+	})
+}
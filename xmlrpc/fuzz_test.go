@@ -0,0 +1,128 @@
+//go:build go1.18
+// +build go1.18
+
+package xmlrpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// fuzzSeeds are responses as sent by rTorrent
+var fuzzSeeds = []string{
+	// d.multicall2 on the main view
+	`<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><array><data>
+<value><array><data>
+<value><string>Some.Linux.Distribution.iso</string></value>
+<value><i8>4294967296</i8></value>
+<value><string>1D5B5F2F6BD2C6B5B4A17D24A4B1F2A2F1B1A2C3</string></value>
+<value><string>label</string></value>
+<value><string>/downloads/temp/Some.Linux.Distribution.iso</string></value>
+<value><i8>1</i8></value>
+<value><i8>0</i8></value>
+<value><i8>1500</i8></value>
+<value><i8>1600000000</i8></value>
+</data></array></value>
+</data></array></value></param>
+</params>
+</methodResponse>
+`,
+	// d.name on an unknown hash
+	`<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<fault>
+<value><struct>
+<member><name>faultCode</name>
+<value><i4>-501</i4></value></member>
+<member><name>faultString</name>
+<value><string>Could not find info-hash.</string></value></member>
+</struct></value>
+</fault>
+</methodResponse>
+`,
+	// system.multicall of d.name and d.size_bytes
+	`<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><array><data>
+<value><array><data>
+<value><string>Some.Linux.Distribution.iso</string></value>
+</data></array></value>
+<value><struct>
+<member><name>faultCode</name>
+<value><i4>-506</i4></value></member>
+<member><name>faultString</name>
+<value><string>Method 'd.size_byte' not defined</string></value></member>
+</struct></value>
+</data></array></value></param>
+</params>
+</methodResponse>
+`,
+	// load.raw_start as received by a server
+	`<?xml version="1.0"?><methodCall><methodName>load.raw_start</methodName><params>` +
+		`<param><value><string></string></value></param>` +
+		`<param><value><base64>ZDg6YW5ub3VuY2U=</base64></value></param>` +
+		`<param><value><string>d.custom1.set="label"</string></value></param>` +
+		`</params></methodCall>`,
+	`<methodResponse><params><param><value><i8>0</i8></value></param></params></methodResponse>`,
+	`<methodResponse><params><param><value><double>1.5</double></value></param></params></methodResponse>`,
+	`<methodResponse><params><param><value><dateTime.iso8601>20200101T00:00:00</dateTime.iso8601></value></param></params></methodResponse>`,
+}
+
+// fuzzLimits are small enough for the fuzzer to hit them
+var fuzzLimits = Limits{MaxResponseBytes: 1 << 16, MaxDepth: 8, MaxArrayLength: 64, MaxStringLength: 256}
+
+func FuzzUnmarshal(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, params, _, err := UnmarshalLimits(strings.NewReader(string(data)), fuzzLimits)
+		if err != nil {
+			return
+		}
+		if err := fuzzLimits.checkParams(params); err != nil {
+			t.Fatalf("limits exceeded by %q: %v", data, err)
+		}
+
+		// streaming has to agree with Unmarshal on the limits
+		_, err = UnmarshalEachLimits(strings.NewReader(string(data)), fuzzLimits, func(interface{}) error { return nil })
+		var limitErr *LimitError
+		if errors.As(err, &limitErr) {
+			t.Fatalf("UnmarshalEachLimits failed on %q, which Unmarshal accepts: %v", data, err)
+		}
+	})
+}
+
+func FuzzParseValue(f *testing.F) {
+	for _, seed := range []string{
+		`<value><string>Some.Linux.Distribution.iso</string></value>`,
+		`<value><i8>4294967296</i8></value>`,
+		`<value><array><data><value><i8>1</i8></value><value><string>label</string></value></data></array></value>`,
+		`<value><struct><member><name>faultCode</name><value><i4>-501</i4></value></member></struct></value>`,
+		`<value><base64>ZDg6YW5ub3VuY2U=</base64></value>`,
+		`<value><boolean>1</boolean></value>`,
+		`<value><nil/></value>`,
+		`<value><ex:i8 xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions">-1</ex:i8></value>`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		st := newLimitedParser(strings.NewReader(string(data)), fuzzLimits)
+		v, err := st.parseValue()
+		if err != nil {
+			return
+		}
+		if err := fuzzLimits.check(v); err != nil {
+			t.Fatalf("limits exceeded by %q: %v", data, err)
+		}
+		if st.level != 0 {
+			t.Fatalf("unbalanced depth %d after %q", st.level, data)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Invoker performs a call of method with args
+type Invoker func(ctx context.Context, method string, args []interface{}) (interface{}, error)
+
+// Interceptor is called for every call of a Client instead of sending it directly.
+// It may inspect or modify the call and its result, and has to call next to continue with the call.
+//
+// Example:
+//  func(ctx context.Context, method string, args []interface{}, next xmlrpc.Invoker) (interface{}, error) {
+//  	ctx, span := tracer.Start(ctx, method)
+//  	defer span.End()
+//  	return next(ctx, method, args)
+//  }
+type Interceptor func(ctx context.Context, method string, args []interface{}, next Invoker) (interface{}, error)
+
+// WithInterceptors adds interceptors to a Client. The first interceptor is the outermost one.
+// Interceptors see each logical call once, retries happen inside of next.
+// Batches are seen as a single system.multicall call.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// chainInterceptors returns an Invoker calling the interceptors in order before invoking last
+func chainInterceptors(interceptors []Interceptor, last Invoker) Invoker {
+	invoker := last
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, method string, args []interface{}) (interface{}, error) {
+			return interceptor(ctx, method, args, next)
+		}
+	}
+	return invoker
+}
+
+// LoggingInterceptor logs every call with its duration and error, if any.
+// log receives a message and alternating keys and values, which fits most structured loggers:
+//  xmlrpc.LoggingInterceptor(func(msg string, keyvals ...interface{}) {
+//  	logger.Debugw(msg, keyvals...)
+//  })
+func LoggingInterceptor(log func(msg string, keyvals ...interface{})) Interceptor {
+	return func(ctx context.Context, method string, args []interface{}, next Invoker) (interface{}, error) {
+		start := time.Now()
+		result, err := next(ctx, method, args)
+		keyvals := []interface{}{"method", method, "duration", time.Since(start)}
+		if err != nil {
+			log("xmlrpc call failed", append(keyvals, "error", err)...)
+		} else {
+			log("xmlrpc call", keyvals...)
+		}
+		return result, err
+	}
+}
+
+// LatencyInterceptor reports the duration and error of every call to observe, e.g. to record it in a histogram
+func LatencyInterceptor(observe func(method string, duration time.Duration, err error)) Interceptor {
+	return func(ctx context.Context, method string, args []interface{}, next Invoker) (interface{}, error) {
+		start := time.Now()
+		result, err := next(ctx, method, args)
+		observe(method, time.Since(start), err)
+		return result, err
+	}
+}
+
+// DumpInterceptor writes every call and its result or fault to w, encoded as XMLRPC with nil written as <nil/>.
+// Transport errors are written as comments. Writes of concurrent calls are not interleaved.
+func DumpInterceptor(w io.Writer) Interceptor {
+	var mu sync.Mutex
+	enc := Encoder{Nil: true}
+	return func(ctx context.Context, method string, args []interface{}, next Invoker) (interface{}, error) {
+		var req bytes.Buffer
+		if err := enc.Marshal(&req, method, args...); err != nil {
+			fmt.Fprintf(&req, "<!-- failed to dump request: %v -->", err)
+		}
+
+		result, err := next(ctx, method, args)
+
+		var resp bytes.Buffer
+		var dumpErr error
+		var fault *Fault
+		if errors.As(err, &fault) {
+			dumpErr = Marshal(&resp, "", fault)
+		} else if result == nil && err == nil {
+			// streamed by CallEach
+			fmt.Fprintf(&resp, "<!-- %s streamed -->", method)
+		} else if params, ok := result.([]interface{}); ok && err == nil {
+			dumpErr = enc.Marshal(&resp, "", params...)
+		} else if err == nil {
+			dumpErr = enc.Marshal(&resp, "", result)
+		} else {
+			dumpErr = err
+		}
+		if dumpErr != nil {
+			resp.Reset()
+			fmt.Fprintf(&resp, "<!-- %s failed: %v -->", method, dumpErr)
+		}
+
+		mu.Lock()
+		fmt.Fprintf(w, "%s\n%s\n", req.Bytes(), resp.Bytes())
+		mu.Unlock()
+		return result, err
+	}
+}
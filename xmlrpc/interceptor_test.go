@@ -0,0 +1,121 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptors(t *testing.T) {
+	srv := newTestServer(t, func(name string, params []interface{}) interface{} {
+		if name == "d.fail" {
+			return &Fault{Code: -501, Message: "Could not find info-hash."}
+		}
+		return "called " + name
+	})
+
+	t.Run("order", func(t *testing.T) {
+		var calls []string
+		trace := func(name string) Interceptor {
+			return func(ctx context.Context, method string, args []interface{}, next Invoker) (interface{}, error) {
+				calls = append(calls, name+" before "+method)
+				result, err := next(ctx, method, args)
+				calls = append(calls, name+" after "+method)
+				return result, err
+			}
+		}
+		client := NewClient(srv.URL, false, WithInterceptors(trace("outer")), WithInterceptors(trace("inner")))
+		_, err := client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		require.Equal(t, []string{"outer before d.name", "inner before d.name", "inner after d.name", "outer after d.name"}, calls)
+	})
+
+	t.Run("modify call and result", func(t *testing.T) {
+		client := NewClient(srv.URL, false, WithInterceptors(
+			func(ctx context.Context, method string, args []interface{}, next Invoker) (interface{}, error) {
+				result, err := next(ctx, "d."+method, args)
+				return []interface{}{result, "intercepted"}, err
+			},
+		))
+		result, err := client.Call("hash")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{[]interface{}{"called d.hash"}, "intercepted"}, result)
+	})
+
+	t.Run("short circuit", func(t *testing.T) {
+		client := NewClient("http://127.0.0.1:1", false, WithInterceptors(
+			func(ctx context.Context, method string, args []interface{}, next Invoker) (interface{}, error) {
+				return []interface{}{"cached"}, nil
+			},
+		))
+		result, err := client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"cached"}, result)
+	})
+
+	t.Run("logging", func(t *testing.T) {
+		var messages []string
+		var keys [][]interface{}
+		client := NewClient(srv.URL, false, WithInterceptors(LoggingInterceptor(func(msg string, keyvals ...interface{}) {
+			messages = append(messages, msg)
+			keys = append(keys, keyvals)
+		})))
+		_, err := client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		_, err = client.Call("d.fail", "ABC")
+		require.Error(t, err)
+
+		require.Equal(t, []string{"xmlrpc call", "xmlrpc call failed"}, messages)
+		require.Len(t, keys[0], 4)
+		require.Equal(t, "method", keys[0][0])
+		require.Equal(t, "d.name", keys[0][1])
+		require.Equal(t, "duration", keys[0][2])
+		require.Len(t, keys[1], 6)
+		require.Equal(t, "error", keys[1][4])
+		require.Equal(t, err, keys[1][5])
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		var observed int32
+		var lastErr error
+		client := NewClient(srv.URL, false, WithInterceptors(LatencyInterceptor(func(method string, duration time.Duration, err error) {
+			require.Equal(t, "d.fail", method)
+			require.True(t, duration > 0)
+			lastErr = err
+			atomic.AddInt32(&observed, 1)
+		})))
+		_, err := client.Call("d.fail", "ABC")
+		require.Error(t, err)
+		require.Equal(t, err, lastErr)
+		require.EqualValues(t, 1, atomic.LoadInt32(&observed))
+	})
+
+	t.Run("dump", func(t *testing.T) {
+		var dump bytes.Buffer
+		client := NewClient(srv.URL, false, WithInterceptors(DumpInterceptor(&dump)))
+		_, err := client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		_, err = client.Call("d.fail", "ABC")
+		require.Error(t, err)
+		_, err = NewClient("http://127.0.0.1:1", false, WithInterceptors(DumpInterceptor(&dump))).Call("d.name", "ABC")
+		require.Error(t, err)
+
+		// each call is dumped as its request followed by its response
+		out := dump.String()
+		pos := 0
+		for _, want := range []string{
+			"<methodName>d.name</methodName>", "<string>ABC</string>", "<methodResponse>", "<string>called d.name</string>",
+			"<methodName>d.fail</methodName>", "<fault>", "Could not find info-hash.",
+			"<methodName>d.name</methodName>", "<!-- d.name failed: POST failed",
+		} {
+			i := strings.Index(out[pos:], want)
+			require.True(t, i >= 0, "%q missing after offset %d in %s", want, pos, out)
+			pos += i + len(want)
+		}
+	})
+}
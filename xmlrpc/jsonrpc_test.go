@@ -0,0 +1,254 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newCodecTestServer(t *testing.T) *Server {
+	srv := NewServer()
+	require.NoError(t, srv.Register("d.name", func(hash string) (string, error) {
+		if hash != "ABC" {
+			return "", &Fault{Code: -501, Message: "Could not find info-hash."}
+		}
+		return "name-of-" + hash, nil
+	}))
+	require.NoError(t, srv.Register("d.multicall2", func(target, view string, fields ...string) [][]interface{} {
+		return [][]interface{}{
+			{"ABC", 1 << 30, 1.5, true, []string{"a", "b"}},
+			{"DEF", -1, 0.25, false, []string{}},
+		}
+	}))
+	require.NoError(t, srv.Register("d.row", func(row struct {
+		Name string `xmlrpc:"name"`
+		Size int    `xmlrpc:"size"`
+	}) map[string]interface{} {
+		return map[string]interface{}{"name": row.Name, "size": row.Size}
+	}))
+	return srv
+}
+
+func TestCodecs(t *testing.T) {
+	ts := httptest.NewServer(newCodecTestServer(t))
+	defer ts.Close()
+
+	xmlClient := NewClient(ts.URL, false)
+	jsonClient := NewClient(ts.URL, false, WithCodec(JSONCodec))
+
+	for _, call := range []struct {
+		method string
+		args   []interface{}
+	}{
+		{"d.name", []interface{}{"ABC"}},
+		{"d.multicall2", []interface{}{"", "main", "d.hash=", "d.size_bytes="}},
+		{"d.row", []interface{}{struct {
+			Name string `xmlrpc:"name"`
+			Size int    `xmlrpc:"size"`
+		}{"a", 42}}},
+		{"system.listMethods", nil},
+	} {
+		want, err := xmlClient.Call(call.method, call.args...)
+		require.NoError(t, err)
+		got, err := jsonClient.Call(call.method, call.args...)
+		require.NoError(t, err)
+		require.Equal(t, want, got, call.method)
+	}
+
+	t.Run("faults", func(t *testing.T) {
+		_, err := jsonClient.Call("d.name", "XYZ")
+		var fault *Fault
+		require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+		require.Equal(t, &Fault{Code: -501, Message: "Could not find info-hash."}, fault)
+
+		_, err = jsonClient.Call("d.missing")
+		require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+		require.Equal(t, FaultMethodNotFound, fault.Code)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		want, err := xmlClient.NewBatch().Add("d.name", "ABC").Add("d.name", "XYZ").Run()
+		require.NoError(t, err)
+		got, err := jsonClient.NewBatch().Add("d.name", "ABC").Add("d.name", "XYZ").Run()
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("unexpected content type", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/xml")
+			Marshal(w, "", "xml")
+		}))
+		defer srv.Close()
+		_, err := NewClient(srv.URL, false, WithCodec(JSONCodec)).Call("d.name")
+		var ctErr *ContentTypeError
+		require.True(t, errors.As(err, &ctErr), "unexpected error: %v", err)
+	})
+}
+
+func TestJSONServer(t *testing.T) {
+	ts := httptest.NewServer(newCodecTestServer(t))
+	defer ts.Close()
+
+	post := func(body string) map[string]interface{} {
+		resp, err := http.Post(ts.URL, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		var v map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+		return v
+	}
+
+	require.Equal(t, map[string]interface{}{"jsonrpc": "2.0", "id": "x", "result": "name-of-ABC"},
+		post(`{"jsonrpc":"2.0","method":"d.name","params":["ABC"],"id":"x"}`))
+	require.Equal(t, map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": map[string]interface{}{
+		"code": float64(FaultParseError), "message": "unexpected EOF",
+	}}, post(`{"jsonrpc":`))
+	require.Equal(t, map[string]interface{}{"jsonrpc": "2.0", "id": float64(1), "error": map[string]interface{}{
+		"code": float64(FaultInvalidParams), "message": "params must be an array",
+	}}, post(`{"jsonrpc":"2.0","method":"d.name","params":{"hash":"ABC"},"id":1}`))
+}
+
+func TestJSONCodec(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, JSONCodec.EncodeRequest(&b, "load.raw", []interface{}{"", []byte("data"), &struct {
+		Name    string `xmlrpc:"name"`
+		private int
+	}{Name: "a"}}))
+	var req map[string]interface{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &req))
+	require.Equal(t, "2.0", req["jsonrpc"])
+	require.Equal(t, "load.raw", req["method"])
+	require.Equal(t, []interface{}{"", "ZGF0YQ==", map[string]interface{}{"name": "a"}}, req["params"])
+	require.NotNil(t, req["id"])
+
+	params, err := JSONCodec.DecodeResponse(strings.NewReader(`{"jsonrpc":"2.0","id":1,"result":[1,2.5,9007199254740993,null,{"a":[-3]}]}`))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{[]interface{}{1, 2.5, int64(9007199254740993), nil, map[string]interface{}{"a": []interface{}{-3}}}}, params)
+
+	_, err = JSONCodec.DecodeResponse(strings.NewReader(`{"jsonrpc":"2.0","id":1}`))
+	require.Error(t, err)
+	_, err = JSONCodec.DecodeResponse(strings.NewReader(`<methodResponse>`))
+	require.Error(t, err)
+}
+
+func TestJSONResponseID(t *testing.T) {
+	// a server answering with a response for another request, as a misbehaving proxy might
+	respond := func(id func(req json.RawMessage) interface{}, result string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req jsonRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			w.Header().Set("Content-Type", "application/json")
+			b, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id(req.ID)})
+			require.NoError(t, err)
+			w.Write([]byte(strings.TrimSuffix(string(b), "}") + "," + result + "}"))
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	same := func(req json.RawMessage) interface{} { return req }
+	stale := func(json.RawMessage) interface{} { return 0 }
+	null := func(json.RawMessage) interface{} { return nil }
+
+	client := NewClient(respond(same, `"result":[1,2]`), false, WithCodec(JSONCodec))
+	result, err := client.Call("d.multicall2", "", "main")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{[]interface{}{1, 2}}, result)
+
+	client = NewClient(respond(stale, `"result":[1,2]`), false, WithCodec(JSONCodec))
+	_, err = client.Call("d.multicall2", "", "main")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "JSON-RPC response has id 0")
+	var elems []interface{}
+	err = client.CallEach(context.Background(), "d.multicall2", []interface{}{"", "main"}, collect(&elems))
+	require.Error(t, err)
+	require.Empty(t, elems)
+
+	client = NewClient(respond(null, `"result":[1,2]`), false, WithCodec(JSONCodec))
+	_, err = client.Call("d.multicall2", "", "main")
+	require.Error(t, err)
+	err = client.CallEach(context.Background(), "d.multicall2", []interface{}{"", "main"}, collect(&elems))
+	require.Error(t, err)
+
+	// errors about the request itself may come without its id
+	client = NewClient(respond(null, `"error":{"code":-32700,"message":"Parse error"}`), false, WithCodec(JSONCodec))
+	_, err = client.Call("d.name", "ABC")
+	var fault *Fault
+	require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+	err = client.CallEach(context.Background(), "d.multicall2", []interface{}{"", "main"}, collect(&elems))
+	require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+
+	client = NewClient(respond(stale, `"error":{"code":-501,"message":"Could not find info-hash."}`), false, WithCodec(JSONCodec))
+	_, err = client.Call("d.name", "ABC")
+	require.False(t, errors.As(err, &fault), "unexpected error: %v", err)
+}
+
+func TestAutoCodec(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		var contentTypes []string
+		srv := newCodecTestServer(t)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+			srv.ServeHTTP(w, r)
+		}))
+		defer ts.Close()
+
+		client := NewClient(ts.URL, false, WithAutoCodec())
+		for i := 0; i < 2; i++ {
+			result, err := client.Call("d.name", "ABC")
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{"name-of-ABC"}, result)
+		}
+		// the probe answered with a method not found fault, which still tells it is JSON-RPC
+		require.Equal(t, []string{"application/json", "application/json", "application/json"}, contentTypes)
+	})
+
+	t.Run("xml only", func(t *testing.T) {
+		var requests int32
+		srv := newTestServer(t, func(name string, params []interface{}) interface{} {
+			atomic.AddInt32(&requests, 1)
+			return "called " + name
+		})
+		// newTestServer fails the test on bodies which aren't XML, answer those like rTorrent does
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.Header.Get("Content-Type"), "json") {
+				w.Header().Set("Content-Type", "text/xml")
+				Marshal(w, "", &Fault{Code: -503, Message: "Could not parse XMLRPC request"})
+				return
+			}
+			resp, err := http.Post(srv.URL, r.Header.Get("Content-Type"), r.Body)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+			var b bytes.Buffer
+			b.ReadFrom(resp.Body)
+			w.Write(b.Bytes())
+		}))
+		defer ts.Close()
+
+		client := NewClient(ts.URL, false, WithAutoCodec())
+		for i := 0; i < 2; i++ {
+			result, err := client.Call("d.name", "ABC")
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{"called d.name"}, result)
+		}
+		require.EqualValues(t, 2, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		client := NewClient("http://127.0.0.1:1", false, WithAutoCodec())
+		_, err := client.CallContext(context.Background(), "d.name", "ABC")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to detect codec")
+		require.Nil(t, client.codec)
+	})
+}
@@ -0,0 +1,172 @@
+package xmlrpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limiter caps the number of requests in flight and the rate at which they are sent, to protect servers
+// which handle one request at a time, like rTorrent. Callers over the limits are queued until it is their turn
+// or their context ends. A Limiter may be shared by several clients of the same server.
+type Limiter struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	interval time.Duration // between tokens, zero if the rate is unlimited
+	burst    float64
+	tokens   float64
+	last     time.Time
+	stats    LimiterStats
+}
+
+// LimiterStats describes the state and the history of a Limiter
+type LimiterStats struct {
+	// InFlight is the number of requests sent and not finished yet
+	InFlight int
+	// Waiting is the number of requests queued
+	Waiting int
+	// Requests is the number of requests which passed the limiter
+	Requests uint64
+	// Canceled is the number of requests whose context ended while they were queued
+	Canceled uint64
+	// TotalWait is the time spent queued by all requests, divide it by Requests for the average
+	TotalWait time.Duration
+	// MaxWait is the longest time a request spent queued
+	MaxWait time.Duration
+}
+
+// NewLimiter returns a Limiter allowing maxInFlight requests at a time and perSecond requests per second,
+// with bursts of up to burst requests. Zero or less for maxInFlight or perSecond means no limit.
+func NewLimiter(maxInFlight int, perSecond float64, burst int) *Limiter {
+	l := &Limiter{burst: float64(burst)}
+	if maxInFlight > 0 {
+		l.slots = make(chan struct{}, maxInFlight)
+	}
+	if perSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	l.tokens = l.burst
+	return l
+}
+
+// WithLimiter sends all requests of a Client through limiter, including retries.
+// A request occupies its slot until its response is read.
+func WithLimiter(limiter *Limiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// Stats returns the current statistics of the limiter
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// wait queues the caller until a request may be sent and returns a function to call when the request is finished
+func (l *Limiter) wait(ctx context.Context) (release func(), err error) {
+	start := time.Now()
+	l.update(func(s *LimiterStats) { s.Waiting++ })
+	defer func() {
+		wait := time.Since(start)
+		l.update(func(s *LimiterStats) {
+			s.Waiting--
+			if err != nil {
+				s.Canceled++
+				return
+			}
+			s.InFlight++
+			s.Requests++
+			s.TotalWait += wait
+			if wait > s.MaxWait {
+				s.MaxWait = wait
+			}
+		})
+	}()
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "canceled while waiting for the limiter")
+		}
+	}
+	if err := l.takeToken(ctx); err != nil {
+		if l.slots != nil {
+			<-l.slots
+		}
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if l.slots != nil {
+				<-l.slots
+			}
+			l.update(func(s *LimiterStats) { s.InFlight-- })
+		})
+	}, nil
+}
+
+// takeToken takes a token from the bucket, waiting for one if it is empty
+func (l *Limiter) takeToken(ctx context.Context) error {
+	if l.interval == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	// the token is reserved right away, so queued callers are served in order
+	l.tokens--
+	delay := time.Duration(-l.tokens * float64(l.interval))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// give the reservation back to those queued behind
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return errors.Wrap(ctx.Err(), "canceled while waiting for the limiter")
+	}
+}
+
+func (l *Limiter) update(fn func(s *LimiterStats)) {
+	l.mu.Lock()
+	fn(&l.stats)
+	l.mu.Unlock()
+}
+
+// releaseOnClose calls release when body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
@@ -0,0 +1,160 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// newBlockingServer returns a server whose calls block until release is closed, tracking the concurrent calls
+func newBlockingServer(t *testing.T, release <-chan struct{}) (ts *httptest.Server, concurrent func() (current, max int32)) {
+	srv := newCodecTestServer(t)
+	var current, max int32
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&current, -1)
+		srv.ServeHTTP(w, r)
+	}))
+	return ts, func() (int32, int32) { return atomic.LoadInt32(&current), atomic.LoadInt32(&max) }
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("concurrency", func(t *testing.T) {
+		release := make(chan struct{})
+		ts, concurrent := newBlockingServer(t, release)
+		defer ts.Close()
+		limiter := NewLimiter(2, 0, 0)
+		client := NewClient(ts.URL, false, WithLimiter(limiter))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := client.Call("d.name", "ABC")
+				require.NoError(t, err)
+			}()
+		}
+		for current, _ := concurrent(); current < 2 || limiter.Stats().Waiting < 18; current, _ = concurrent() {
+			time.Sleep(time.Millisecond)
+		}
+		require.Equal(t, 2, limiter.Stats().InFlight)
+		close(release)
+		wg.Wait()
+
+		_, max := concurrent()
+		require.Equal(t, int32(2), max)
+		stats := limiter.Stats()
+		require.Equal(t, uint64(20), stats.Requests)
+		require.Zero(t, stats.InFlight)
+		require.Zero(t, stats.Waiting)
+		require.Zero(t, stats.Canceled)
+		require.True(t, stats.MaxWait > 0)
+		require.True(t, stats.TotalWait >= stats.MaxWait)
+	})
+
+	t.Run("canceled while queued", func(t *testing.T) {
+		release := make(chan struct{})
+		ts, _ := newBlockingServer(t, release)
+		defer ts.Close()
+		limiter := NewLimiter(1, 0, 0)
+		client := NewClient(ts.URL, false, WithLimiter(limiter))
+
+		done := make(chan error)
+		go func() {
+			_, err := client.Call("d.name", "ABC")
+			done <- err
+		}()
+		for limiter.Stats().InFlight < 1 {
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := client.CallContext(ctx, "d.name", "ABC")
+		require.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+		require.Equal(t, uint64(1), limiter.Stats().Canceled)
+		require.Zero(t, limiter.Stats().Waiting)
+
+		close(release)
+		require.NoError(t, <-done)
+		// the slot is free again
+		_, err = client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), limiter.Stats().Requests)
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		ts := httptest.NewServer(newCodecTestServer(t))
+		defer ts.Close()
+		limiter := NewLimiter(0, 100, 5)
+		client := NewClient(ts.URL, false, WithLimiter(limiter))
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			_, err := client.Call("d.name", "ABC")
+			require.NoError(t, err)
+		}
+		require.True(t, time.Since(start) < 40*time.Millisecond, "burst took %v", time.Since(start))
+
+		for i := 0; i < 10; i++ {
+			_, err := client.Call("d.name", "ABC")
+			require.NoError(t, err)
+		}
+		// 10 requests beyond the burst take at least 100ms, give or take the refill during the burst
+		require.True(t, time.Since(start) >= 80*time.Millisecond, "requests took %v", time.Since(start))
+		require.True(t, limiter.Stats().MaxWait > 0)
+	})
+
+	t.Run("rate canceled", func(t *testing.T) {
+		ts := httptest.NewServer(newCodecTestServer(t))
+		defer ts.Close()
+		limiter := NewLimiter(0, 1, 1)
+		client := NewClient(ts.URL, false, WithLimiter(limiter))
+
+		_, err := client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err = client.CallContext(ctx, "d.name", "ABC")
+		require.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+		require.True(t, time.Since(start) < 500*time.Millisecond)
+		require.Equal(t, uint64(1), limiter.Stats().Canceled)
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		ts := httptest.NewServer(newCodecTestServer(t))
+		defer ts.Close()
+		limiter := NewLimiter(1, 0, 0)
+		client := NewClient(ts.URL, false, WithLimiter(limiter))
+
+		err := client.CallEach(context.Background(), "d.multicall2", []interface{}{"", "main"}, func(interface{}) error {
+			require.Equal(t, 1, limiter.Stats().InFlight)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Zero(t, limiter.Stats().InFlight)
+
+		// failed calls release their slot too
+		_, err = client.Call("d.name", "XYZ")
+		require.Error(t, err)
+		_, err = client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		require.Zero(t, limiter.Stats().InFlight)
+	})
+}
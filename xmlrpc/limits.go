@@ -0,0 +1,151 @@
+package xmlrpc
+
+import (
+	"fmt"
+	"io"
+)
+
+// Limits bounds the resources spent on parsing a message, so a misbehaving or malicious endpoint
+// cannot exhaust memory or the stack. A zero field means no limit.
+//
+// encoding/xml does not expand entities declared in a DTD, so entity expansion is not a concern;
+// messages containing a DOCTYPE are rejected altogether.
+type Limits struct {
+	// MaxResponseBytes is the maximum size of a message in bytes
+	MaxResponseBytes int64
+	// MaxDepth is the maximum nesting depth of arrays and structs
+	MaxDepth int
+	// MaxArrayLength is the maximum number of elements of an array, or members of a struct
+	MaxArrayLength int
+	// MaxStringLength is the maximum length of a string or base64 value in bytes
+	MaxStringLength int
+}
+
+// DefaultLimits are used by Unmarshal, Server and Client unless configured otherwise.
+// They are generous enough for d.multicall2 on hundreds of thousands of torrents.
+var DefaultLimits = Limits{
+	MaxResponseBytes: 1 << 30,
+	MaxDepth:         64,
+	MaxArrayLength:   1 << 22,
+	MaxStringLength:  64 << 20,
+}
+
+// WithLimits sets the limits applied to responses, replacing DefaultLimits
+func WithLimits(limits Limits) Option {
+	return func(c *Client) {
+		c.limits = limits
+	}
+}
+
+// LimitError is returned when a message exceeds one of the Limits
+type LimitError struct {
+	// Limit names the exceeded limit: "response bytes", "depth", "array length" or "string length"
+	Limit string
+	// Max is the configured maximum
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("xmlrpc: message exceeds the %s limit of %d", e.Limit, e.Max)
+}
+
+// limitReader returns a reader which fails with a *LimitError once more than max bytes are read from r
+func limitReader(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, remaining: max + 1, max: max}
+}
+
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	max       int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, &LimitError{Limit: "response bytes", Max: l.max}
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining <= 0 {
+		// the byte beyond the limit proves the message is too large
+		return n - 1, &LimitError{Limit: "response bytes", Max: l.max}
+	}
+	return n, err
+}
+
+// check verifies an already decoded value against the limits, for codecs which cannot enforce them while parsing
+func (l Limits) check(v interface{}) error {
+	return l.checkDepth(v, 0)
+}
+
+// checkParams verifies the params of a message against the limits
+func (l Limits) checkParams(params []interface{}) error {
+	if err := l.checkLength(len(params)); err != nil {
+		return err
+	}
+	for _, param := range params {
+		if err := l.check(param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l Limits) checkDepth(v interface{}, depth int) error {
+	switch v := v.(type) {
+	case string:
+		return l.checkString(len(v))
+	case []byte:
+		return l.checkString(len(v))
+	case []interface{}:
+		if err := l.enter(depth+1, len(v)); err != nil {
+			return err
+		}
+		for _, elem := range v {
+			if err := l.checkDepth(elem, depth+1); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if err := l.enter(depth+1, len(v)); err != nil {
+			return err
+		}
+		for key, elem := range v {
+			if err := l.checkString(len(key)); err != nil {
+				return err
+			}
+			if err := l.checkDepth(elem, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enter checks the depth of an array or struct and its number of elements
+func (l Limits) enter(depth, length int) error {
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return &LimitError{Limit: "depth", Max: int64(l.MaxDepth)}
+	}
+	return l.checkLength(length)
+}
+
+func (l Limits) checkLength(length int) error {
+	if l.MaxArrayLength > 0 && length > l.MaxArrayLength {
+		return &LimitError{Limit: "array length", Max: int64(l.MaxArrayLength)}
+	}
+	return nil
+}
+
+func (l Limits) checkString(length int) error {
+	if l.MaxStringLength > 0 && length > l.MaxStringLength {
+		return &LimitError{Limit: "string length", Max: int64(l.MaxStringLength)}
+	}
+	return nil
+}
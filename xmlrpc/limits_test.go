@@ -0,0 +1,148 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// nested returns a methodResponse with arrays nested depth levels deep
+func nested(depth int) string {
+	return "<methodResponse><params><param><value>" +
+		strings.Repeat("<array><data><value>", depth) + "<int>1</int>" + strings.Repeat("</value></data></array>", depth) +
+		"</value></param></params></methodResponse>"
+}
+
+func requireLimitError(t *testing.T, err error, limit string) {
+	t.Helper()
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr), "unexpected error: %v", err)
+	require.Equal(t, limit, limitErr.Limit)
+}
+
+func TestLimits(t *testing.T) {
+	marshal := func(params ...interface{}) string {
+		var b bytes.Buffer
+		require.NoError(t, Marshal(&b, "", params...))
+		return b.String()
+	}
+	limits := Limits{MaxResponseBytes: 1024, MaxDepth: 3, MaxArrayLength: 4, MaxStringLength: 8}
+
+	for _, tc := range []struct {
+		name  string
+		body  string
+		limit string
+	}{
+		{"response bytes", marshal(strings.Repeat("a", 2048)), "response bytes"},
+		{"depth", nested(4), "depth"},
+		{"array length", marshal([]interface{}{1, 2, 3, 4, 5}), "array length"},
+		{"struct members", marshal(map[string]interface{}{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}), "array length"},
+		{"params", marshal(1, 2, 3, 4, 5), "array length"},
+		{"string length", marshal("123456789"), "string length"},
+		{"member name length", marshal(map[string]interface{}{"123456789": 1}), "string length"},
+		{"base64 length", marshal([]byte("123456789")), "string length"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, err := UnmarshalLimits(strings.NewReader(tc.body), limits)
+			requireLimitError(t, err, tc.limit)
+
+			_, _, _, err = UnmarshalLimits(strings.NewReader(tc.body), Limits{})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		_, params, _, err := UnmarshalLimits(strings.NewReader(nested(3)), limits)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{[]interface{}{[]interface{}{[]interface{}{1}}}}, params)
+
+		_, params, _, err = UnmarshalLimits(strings.NewReader(marshal([]interface{}{"12345678", 2, 3, 4})), limits)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{[]interface{}{"12345678", 2, 3, 4}}, params)
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		_, err := UnmarshalEachLimits(strings.NewReader(marshal([]interface{}{1, 2, 3, 4, 5})), limits, collect(new([]interface{})))
+		requireLimitError(t, err, "array length")
+		_, err = UnmarshalEachLimits(strings.NewReader(nested(4)), limits, collect(new([]interface{})))
+		requireLimitError(t, err, "depth")
+		_, err = UnmarshalEachLimits(strings.NewReader(nested(3)), limits, collect(new([]interface{})))
+		require.NoError(t, err)
+	})
+
+	t.Run("default limits", func(t *testing.T) {
+		_, _, _, err := Unmarshal(strings.NewReader(nested(DefaultLimits.MaxDepth + 1)))
+		requireLimitError(t, err, "depth")
+		_, _, _, err = Unmarshal(strings.NewReader(nested(DefaultLimits.MaxDepth)))
+		require.NoError(t, err)
+	})
+
+	t.Run("nested values", func(t *testing.T) {
+		body := "<methodResponse><params><param><value>" + strings.Repeat("<value>", 5) + "<int>1</int>" + strings.Repeat("</value>", 5) + "</value></param></params></methodResponse>"
+		_, _, _, err := Unmarshal(strings.NewReader(body))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "value nested in value")
+	})
+
+	t.Run("doctype", func(t *testing.T) {
+		body := `<?xml version="1.0"?><!DOCTYPE lolz [<!ENTITY lol "lol">]>` + marshal("a")
+		_, _, _, err := Unmarshal(strings.NewReader(body))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "DOCTYPE")
+	})
+}
+
+func TestClientLimits(t *testing.T) {
+	ts := httptest.NewServer(newCodecTestServer(t))
+	defer ts.Close()
+	limits := Limits{MaxArrayLength: 1}
+
+	for _, codec := range []Codec{XMLCodec, JSONCodec, plainCodec{XMLCodec}} {
+		client := NewClient(ts.URL, false, WithCodec(codec), WithLimits(limits))
+
+		_, err := client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		_, err = client.Call("d.multicall2", "", "main")
+		requireLimitError(t, err, "array length")
+
+		err = client.CallEach(context.Background(), "d.multicall2", []interface{}{"", "main"}, collect(new([]interface{})))
+		requireLimitError(t, err, "array length")
+
+		_, err = NewClient(ts.URL, false, WithCodec(codec), WithLimits(Limits{MaxResponseBytes: 16})).Call("d.name", "ABC")
+		requireLimitError(t, err, "response bytes")
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	srv := newCodecTestServer(t)
+	srv.Limits = &Limits{MaxDepth: 8, MaxStringLength: 4}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for _, codec := range []Codec{XMLCodec, JSONCodec} {
+		client := NewClient(ts.URL, false, WithCodec(codec))
+		_, err := client.Call("d.name", "ABC")
+		require.NoError(t, err)
+
+		_, err = client.Call("d.name", "ABCDE")
+		var fault *Fault
+		require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+		require.Equal(t, FaultParseError, fault.Code)
+		require.Contains(t, fault.Message, "string length")
+	}
+
+	deep := strings.Replace(nested(100), "methodResponse>", "methodCall><methodName>d.name</methodName>", 1)
+	deep = strings.Replace(deep, "</methodResponse>", "</methodCall>", 1)
+	resp, err := http.Post(ts.URL, "text/xml", strings.NewReader(deep))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, _, fault, err := Unmarshal(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, FaultParseError, fault.Code)
+}
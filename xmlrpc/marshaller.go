@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -80,10 +81,28 @@ type state struct {
 	level     int
 	remainder *interface{}
 	last      *xml.Token
+	limits    Limits
+	inValue   bool
 }
 
 func newParser(p *xml.Decoder) *state {
-	return &state{p, 0, nil, nil}
+	return &state{p: p}
+}
+
+// newLimitedParser returns a parser reading from r which enforces limits
+func newLimitedParser(r io.Reader, limits Limits) *state {
+	st := newParser(xml.NewDecoder(limitReader(r, limits.MaxResponseBytes)))
+	st.limits = limits
+	return st
+}
+
+// enter descends into an array or struct, checking the depth limit
+func (st *state) enter() error {
+	st.level++
+	if st.limits.MaxDepth > 0 && st.level > st.limits.MaxDepth {
+		return &LimitError{Limit: "depth", Max: int64(st.limits.MaxDepth)}
+	}
+	return nil
 }
 
 const (
@@ -107,32 +126,51 @@ func (st *state) parseValue() (nv interface{}, e error) {
 		return
 	}
 
+	// a value directly nested in a value is invalid, rejecting it bounds the recursion without arrays or structs
+	nested := st.inValue
+	st.inValue = se.Name.Local == "value"
+
 	var vn valueNode
 	switch se.Name.Local {
 	case "value":
-		if nv, e = st.parseValue(); e == nil {
+		if nested {
+			e = errors.New("value nested in value")
+			return
+		}
+		nv, e = st.parseValue()
+		// an untyped or empty value has no start element to reset the flag, so the next value would seem nested
+		st.inValue = false
+		if e == nil {
 			e = st.checkLast("value")
 		}
 		return
-	case "boolean", "string", "int", "i1", "i2", "i4", "i8", "double", "dateTime.iso8601", "base64": //simple
+	case "boolean", "string", "int", "i1", "i2", "i4", "i8", "double", "dateTime.iso8601", "base64", "nil": //simple
 		st.last = nil
 		if e = st.p.DecodeElement(&vn, &se); e != nil {
 			return
 		}
+		if se.Name.Local == "string" || se.Name.Local == "base64" {
+			if e = st.limits.checkString(len(vn.Body)); e != nil {
+				return
+			}
+		}
 
+		// the ex: types of the Apache extensions, e.g. <ex:i8>, are matched by their local name
 		switch se.Name.Local {
+		case "nil":
+			nv = nil
 		case "boolean":
 			nv, e = strconv.ParseBool(vn.Body)
 		case "string":
 			nv = vn.Body
 		case "int", "i1", "i2", "i4":
+			// some servers send 64-bit values as int, only those which fit in 32 bits are decoded as int
 			var i64 int64
-			i64, e = strconv.ParseInt(vn.Body, 10, 32)
-			nv = int(i64)
+			if i64, e = strconv.ParseInt(vn.Body, 10, 64); e == nil {
+				nv = intValue(i64)
+			}
 		case "i8":
-			var i64 int64
-			i64, e = strconv.ParseInt(vn.Body, 10, 64)
-			nv = int(i64)
+			nv, e = strconv.ParseInt(vn.Body, 10, 64)
 		case "double":
 			nv, e = strconv.ParseFloat(vn.Body, 64)
 		case "dateTime.iso8601":
@@ -148,6 +186,10 @@ func (st *state) parseValue() (nv interface{}, e error) {
 		return
 
 	case "struct":
+		if e = st.enter(); e != nil {
+			return
+		}
+		defer func() { st.level-- }()
 		var name string
 		values := make(map[string]interface{}, 4)
 		nv = values
@@ -162,6 +204,12 @@ func (st *state) parseValue() (nv interface{}, e error) {
 			if name, e = st.getText("name"); e != nil {
 				return
 			}
+			if e = st.limits.checkString(len(name)); e != nil {
+				return
+			}
+			if e = st.limits.checkLength(len(values) + 1); e != nil {
+				return
+			}
 			if se, e = st.getStart("value"); e != nil {
 				return
 			}
@@ -178,6 +226,10 @@ func (st *state) parseValue() (nv interface{}, e error) {
 		return
 
 	case "array":
+		if e = st.enter(); e != nil {
+			return
+		}
+		defer func() { st.level-- }()
 		values := make([]interface{}, 0, 4)
 		var val interface{}
 		if _, e = st.getStart("data"); e != nil {
@@ -191,6 +243,9 @@ func (st *state) parseValue() (nv interface{}, e error) {
 				}
 				return
 			}
+			if e = st.limits.checkLength(len(values) + 1); e != nil {
+				return
+			}
 			if val, e = st.parseValue(); e != nil {
 				return
 			}
@@ -230,6 +285,9 @@ Reading:
 				if ee.Name.Local != "" {
 					break Reading
 				}
+			case xml.Directive:
+				e = errors.New("DOCTYPE and other directives are not allowed")
+				return
 			default:
 			}
 		}
@@ -298,6 +356,30 @@ func (st *state) checkLast(name string) (e error) {
 	return
 }
 
+// intValue returns i as int if it fits in 32 bits, int64 otherwise,
+// so the type of a decoded integer does not depend on the platform
+func intValue(i int64) interface{} {
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		return i
+	}
+	return int(i)
+}
+
+// intTag returns the tag of an integer value: int if it fits in 32 bits, i8 otherwise
+func intTag(r reflect.Value) string {
+	switch r.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if r.Uint() > math.MaxInt32 {
+			return "i8"
+		}
+	default:
+		if i := r.Int(); i < math.MinInt32 || i > math.MaxInt32 {
+			return "i8"
+		}
+	}
+	return "int"
+}
+
 func toXML(v interface{}, typ bool) (s string) {
 	r := reflect.ValueOf(v)
 	t := r.Type()
@@ -317,7 +399,7 @@ func toXML(v interface{}, typ bool) (s string) {
 		reflect.Uint,
 		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		if typ {
-			return fmt.Sprintf("<int>%v</int>", v)
+			return fmt.Sprintf("<%s>%v</%s>", intTag(r), v, intTag(r))
 		}
 		return fmt.Sprintf("%v", v)
 	case reflect.Uintptr:
@@ -375,8 +457,20 @@ func toXML(v interface{}, typ bool) (s string) {
 	return
 }
 
+// Encoder writes values as XMLRPC, the zero Encoder is used by Marshal and WriteXML
+type Encoder struct {
+	// Nil writes nil pointers and interfaces as <nil/>, an Apache XMLRPC extension supported by some servers.
+	// Without it, encoding nil fails with ErrUnsupported.
+	Nil bool
+}
+
 // WriteXML writes v, typed if typ is true, into w Writer
 func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
+	return Encoder{}.WriteXML(w, v, typ)
+}
+
+// WriteXML is like the package function WriteXML, with the options of enc
+func (enc Encoder) WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 	var (
 		r  reflect.Value
 		ok bool
@@ -384,9 +478,16 @@ func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 	// go back from reflect.Value, if needed.
 	if r, ok = v.(reflect.Value); !ok {
 		r = reflect.ValueOf(v)
-	} else {
+	} else if r.IsValid() {
 		v = r.Interface()
 	}
+	if !r.IsValid() || (r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface) && r.IsNil() {
+		if !enc.Nil {
+			return Errorf2(ErrUnsupported, "nil value, see Encoder.Nil")
+		}
+		_, err = io.WriteString(w, "<nil/>")
+		return
+	}
 	if fp, ok := getFault(v); ok {
 		_, err = fp.WriteXML(w)
 		return
@@ -416,7 +517,8 @@ func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 		reflect.Uint,
 		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		if typ {
-			_, err = fmt.Fprintf(w, "<int>%v</int>", v)
+			tag := intTag(r)
+			_, err = fmt.Fprintf(w, "<%s>%v</%s>", tag, v, tag)
 			return err
 		}
 		_, err = fmt.Fprintf(w, "%v", v)
@@ -437,7 +539,7 @@ func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 			if _, err = io.WriteString(w, "  <value>"); err != nil {
 				return
 			}
-			if err = WriteXML(w, r.Index(i).Interface(), typ); err != nil {
+			if err = enc.WriteXML(w, r.Index(i).Interface(), typ); err != nil {
 				return
 			}
 			if _, err = io.WriteString(w, "</value>\n"); err != nil {
@@ -448,7 +550,7 @@ func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 			return
 		}
 	case reflect.Interface:
-		return WriteXML(w, r.Elem(), typ)
+		return enc.WriteXML(w, r.Elem(), typ)
 	case reflect.Map:
 		if _, err = io.WriteString(w, "<struct>\n"); err != nil {
 			return
@@ -463,7 +565,7 @@ func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 			if _, err = io.WriteString(w, "</name><value>"); err != nil {
 				return
 			}
-			if err = WriteXML(w, r.MapIndex(key).Interface(), typ); err != nil {
+			if err = enc.WriteXML(w, r.MapIndex(key).Interface(), typ); err != nil {
 				return
 			}
 			if _, err = io.WriteString(w, "</value></member>\n"); err != nil {
@@ -473,7 +575,7 @@ func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 		_, err = io.WriteString(w, "</struct>")
 		return
 	case reflect.Ptr:
-		return WriteXML(w, reflect.Indirect(r), typ)
+		return enc.WriteXML(w, reflect.Indirect(r), typ)
 	case reflect.String:
 		if typ {
 			_, err = fmt.Fprintf(w, "<string>%v</string>", xmlEscape(v.(string)))
@@ -500,7 +602,7 @@ func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 			if _, err = io.WriteString(w, "</name><value>"); err != nil {
 				return
 			}
-			if err = WriteXML(w, r.Field(i).Interface(), true); err != nil {
+			if err = enc.WriteXML(w, r.Field(i).Interface(), true); err != nil {
 				return
 			}
 			if _, err = io.WriteString(w, "</value></member>"); err != nil {
@@ -510,7 +612,7 @@ func WriteXML(w io.Writer, v interface{}, typ bool) (err error) {
 		_, err = io.WriteString(w, "</struct>")
 		return
 	case reflect.UnsafePointer:
-		return WriteXML(w, r.Elem(), typ)
+		return enc.WriteXML(w, r.Elem(), typ)
 	}
 	return
 }
@@ -543,6 +645,9 @@ func taggedWriteString(w io.Writer, tag, inner string) (n int, err error) {
 }
 
 func getStructFieldName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("xmlrpc"), ",")[0]; name != "" {
+		return name
+	}
 	if sf.Tag.Get("xml") == "" {
 		return sf.Name
 	}
@@ -550,8 +655,13 @@ func getStructFieldName(sf reflect.StructField) string {
 }
 
 // Marshal marshals the named thing (methodResponse if name == "", otherwise a methodCall)
-// into the w Writer
+// into the w Writer. Integers beyond 32 bits are written as i8.
 func Marshal(w io.Writer, name string, args ...interface{}) (err error) {
+	return Encoder{}.Marshal(w, name, args...)
+}
+
+// Marshal is like the package function Marshal, with the options of enc
+func (enc Encoder) Marshal(w io.Writer, name string, args ...interface{}) (err error) {
 	if name == "" {
 		if _, err = io.WriteString(w, "<methodResponse>"); err != nil {
 			return
@@ -584,7 +694,7 @@ func Marshal(w io.Writer, name string, args ...interface{}) (err error) {
 		if _, err = io.WriteString(w, "  <param><value>"); err != nil {
 			return
 		}
-		if err = WriteXML(w, arg, true); err != nil {
+		if err = enc.WriteXML(w, arg, true); err != nil {
 			return
 		}
 		if _, err = io.WriteString(w, "</value></param>\n"); err != nil {
@@ -619,50 +729,30 @@ func getFault(v interface{}) (*Fault, bool) {
 // returns the name of the method call in the first return argument;
 // the params of the call or the response
 // or the Fault if this is a Fault
+//
+// Integers are returned as int if they fit in 32 bits, as int64 if they don't or are sent as i8,
+// which is independent of the size of int on the platform.
+// DefaultLimits are enforced, exceeding them results in a *LimitError.
 func Unmarshal(r io.Reader) (name string, params []interface{}, fault *Fault, e error) {
-	p := xml.NewDecoder(r)
-	st := newParser(p)
+	return UnmarshalLimits(r, DefaultLimits)
+}
+
+// UnmarshalLimits is like Unmarshal but enforces the given limits
+func UnmarshalLimits(r io.Reader, limits Limits) (name string, params []interface{}, fault *Fault, e error) {
+	st := newLimitedParser(r, limits)
 	typ := "methodResponse"
 	if _, e = st.getStart(typ); ErrEq(e, errNameMismatch) { // methodResponse or methodCall
 		typ = "methodCall"
 		if name, e = st.getText("methodName"); e != nil {
 			return
 		}
+	} else if e != nil {
+		return
 	}
 	var se xml.StartElement
 	if se, e = st.getStart("params"); e != nil {
 		if ErrEq(e, errNameMismatch) && se.Name.Local == "fault" {
-			var v interface{}
-			if v, e = st.parseValue(); e != nil {
-				return
-			}
-			fmap, ok := v.(map[string]interface{})
-			if !ok {
-				e = fmt.Errorf("fault not fault: %+v", v)
-				return
-			}
-			fault = &Fault{Code: -1, Message: ""}
-			code, ok := fmap["faultCode"]
-			if !ok {
-				e = fmt.Errorf("no faultCode in fault: %v", fmap)
-				return
-			}
-			fcode, ok := code.(int)
-			if !ok {
-				e = fmt.Errorf("faultCode not int? %v", code)
-				return
-			}
-			fault.Code = int(fcode)
-			msg, ok := fmap["faultString"]
-			if !ok {
-				e = fmt.Errorf("no faultString in fault: %v", fmap)
-				return
-			}
-			if fault.Message, ok = msg.(string); !ok {
-				e = fmt.Errorf("faultString not strin? %v", msg)
-				return
-			}
-			e = st.checkLast("fault")
+			fault, e = st.parseFault()
 		}
 		return
 	}
@@ -676,8 +766,11 @@ func Unmarshal(r io.Reader) (name string, params []interface{}, fault *Fault, e
 			}
 			return
 		}
+		if e = st.limits.checkLength(len(params) + 1); e != nil {
+			return
+		}
 		if v, e = st.parseValue(); e != nil {
-			break
+			return
 		}
 		params = append(params, v)
 		if e = st.checkLast("param"); e != nil {
@@ -690,6 +783,42 @@ func Unmarshal(r io.Reader) (name string, params []interface{}, fault *Fault, e
 	return
 }
 
+// parseFault parses the value of a fault, after its start element
+func (st *state) parseFault() (fault *Fault, e error) {
+	var v interface{}
+	if v, e = st.parseValue(); e != nil {
+		return
+	}
+	fmap, ok := v.(map[string]interface{})
+	if !ok {
+		e = fmt.Errorf("fault not fault: %+v", v)
+		return
+	}
+	fault = &Fault{Code: -1, Message: ""}
+	code, ok := fmap["faultCode"]
+	if !ok {
+		e = fmt.Errorf("no faultCode in fault: %v", fmap)
+		return
+	}
+	fcode, ok := asInt64(code)
+	if !ok {
+		e = fmt.Errorf("faultCode not int? %v", code)
+		return
+	}
+	fault.Code = int(fcode)
+	msg, ok := fmap["faultString"]
+	if !ok {
+		e = fmt.Errorf("no faultString in fault: %v", fmap)
+		return
+	}
+	if fault.Message, ok = msg.(string); !ok {
+		e = fmt.Errorf("faultString not strin? %v", msg)
+		return
+	}
+	e = st.checkLast("fault")
+	return
+}
+
 type errorStruct struct {
 	main    error
 	message string
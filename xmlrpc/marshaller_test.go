@@ -0,0 +1,151 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegers(t *testing.T) {
+	values := []interface{}{
+		0, -1, math.MaxInt32, math.MinInt32,
+		int64(math.MaxInt32) + 1, int64(math.MinInt32) - 1,
+		int64(1) << 53, int64(1)<<53 + 1, int64(math.MaxInt64), int64(math.MinInt64),
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		var b bytes.Buffer
+		require.NoError(t, Marshal(&b, "", values))
+		require.Contains(t, b.String(), "<int>2147483647</int>")
+		require.Contains(t, b.String(), "<i8>2147483648</i8>")
+		require.Contains(t, b.String(), "<i8>9223372036854775807</i8>")
+
+		_, params, _, err := Unmarshal(&b)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{values}, params)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		var b bytes.Buffer
+		require.NoError(t, Marshal(&b, "", uint32(math.MaxUint32), uint8(1)))
+		_, params, _, err := Unmarshal(&b)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{int64(math.MaxUint32), 1}, params)
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		for body, want := range map[string]interface{}{
+			"<i4>-5</i4>":                   -5,
+			"<int>4294967296</int>":         int64(1) << 32,
+			"<i8>7</i8>":                    int64(7),
+			"<i8>9007199254740993</i8>":     int64(1)<<53 + 1,
+			"<i8>-9223372036854775808</i8>": int64(math.MinInt64),
+		} {
+			_, params, _, err := Unmarshal(strings.NewReader("<methodResponse><params><param><value>" + body + "</value></param></params></methodResponse>"))
+			require.NoError(t, err, body)
+			require.Equal(t, []interface{}{want}, params, body)
+		}
+
+		_, _, _, err := Unmarshal(strings.NewReader("<methodResponse><params><param><value><i8>9223372036854775808</i8></value></param></params></methodResponse>"))
+		require.Error(t, err)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var b bytes.Buffer
+		require.NoError(t, JSONCodec.EncodeRequest(&b, "", values))
+		body := strings.Replace(strings.Replace(b.String(), `"params":`, `"result":`, 1), `"method":"",`, "", 1)
+		params, err := JSONCodec.DecodeResponse(strings.NewReader(body))
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{values}, params)
+	})
+}
+
+func TestExtensions(t *testing.T) {
+	t.Run("decode", func(t *testing.T) {
+		body := `<?xml version="1.0"?><methodResponse xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions"><params>` +
+			`<param><value><nil/></value></param>` +
+			`<param><value><ex:nil/></value></param>` +
+			`<param><value><ex:i8>8589934592</ex:i8></value></param>` +
+			`<param><value><ex:i4>-4</ex:i4></value></param>` +
+			`<param><value><array><data><value><ex:nil></ex:nil></value><value><i4>1</i4></value></data></array></value></param>` +
+			`<param><value><struct><member><name>label</name><value><nil/></value></member></struct></value></param>` +
+			`</params></methodResponse>`
+		_, params, _, err := Unmarshal(strings.NewReader(body))
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			nil, nil, int64(8589934592), -4,
+			[]interface{}{nil, 1},
+			map[string]interface{}{"label": nil},
+		}, params)
+
+		// without the namespace declaration, as sent by some proxies
+		_, params, _, err = Unmarshal(strings.NewReader(`<methodResponse><params><param><value><ex:i8>1</ex:i8></value></param></params></methodResponse>`))
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{int64(1)}, params)
+
+		label := new(string)
+		require.NoError(t, Decode(nil, &label))
+		require.Nil(t, label)
+	})
+
+	t.Run("encode", func(t *testing.T) {
+		var label *string
+		var b bytes.Buffer
+		err := Marshal(&b, "d.custom1.set", "ABC", label)
+		require.Error(t, err)
+		require.True(t, ErrEq(err, ErrUnsupported), "unexpected error: %v", err)
+		require.Error(t, Marshal(&b, "", []interface{}{nil}))
+
+		b.Reset()
+		enc := Encoder{Nil: true}
+		require.NoError(t, enc.Marshal(&b, "", label, nil, []interface{}{nil, 1}, map[string]interface{}{"label": nil}))
+		require.Contains(t, b.String(), "<nil/>")
+		_, params, _, err := Unmarshal(&b)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{nil, nil, []interface{}{nil, 1}, map[string]interface{}{"label": nil}}, params)
+	})
+
+	t.Run("client", func(t *testing.T) {
+		srv := NewServer()
+		require.NoError(t, srv.Register("d.custom1.set", func(hash string, label *string) string {
+			if label == nil {
+				return "unset"
+			}
+			return *label
+		}))
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		var label *string
+		_, err := NewClient(ts.URL, false).Call("d.custom1.set", "ABC", label)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "nil value")
+
+		for _, codec := range []Codec{XMLCodec, JSONCodec} {
+			result, err := NewClient(ts.URL, false, WithCodec(codec), WithNilExtension()).Call("d.custom1.set", "ABC", label)
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{"unset"}, result)
+		}
+	})
+}
+
+func TestUntypedValues(t *testing.T) {
+	for body, want := range map[string][]interface{}{
+		`<param><value></value></param><param><value><int>1</int></value></param>`:                               []interface{}{nil, 1},
+		`<param><value><int>1</int></value></param><param><value></value></param><param><value></value></param>`: []interface{}{1, nil, nil},
+		`<param><value><array><data><value></value><value><i4>2</i4></value></data></array></value></param>`:     []interface{}{[]interface{}{nil, 2}},
+	} {
+		_, params, _, err := Unmarshal(strings.NewReader("<methodResponse><params>" + body + "</params></methodResponse>"))
+		require.NoError(t, err, body)
+		require.Equal(t, want, params, body)
+	}
+
+	_, params, _, err := Unmarshal(strings.NewReader(`<methodResponse><params><param><value>abc</value></param><param><value><int>1</int></value></param></params></methodResponse>`))
+	require.NoError(t, err)
+	require.Len(t, params, 2)
+	require.Equal(t, 1, params[1])
+}
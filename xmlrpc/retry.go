@@ -0,0 +1,303 @@
+package xmlrpc
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy describes how failed calls are retried.
+// Only calls of idempotent methods are retried, see DefaultIdempotentMethods and WithIdempotentMethods.
+// Zero fields are replaced by the corresponding field of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after each retry
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction in either direction, e.g. 0.2 for ±20%
+	Jitter float64
+	// Retryable reports whether a failed attempt should be retried, DefaultRetryable if nil
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy makes up to 4 attempts, waiting about 100ms, 200ms and 400ms in between
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	Retryable:      DefaultRetryable,
+}
+
+// DefaultIdempotentMethods are the method name patterns, in path.Match syntax, which are retried
+// by a client with a RetryPolicy. They cover the read-only methods used by the rtorrent package,
+// setters ending in ".set" never match them even if a pattern would.
+// Mutating methods like load.start or d.erase have to be marked safe with WithIdempotentMethods.
+//
+// d.multicall2 and friends run the commands passed as their arguments. Calls with commands matching
+// MutatingCommands, e.g. d.multicall2 with "d.erase=", are not retried unless marked safe explicitly.
+// Only the command names are checked, commands nested in arguments like "d.name={d.erase=}" go unnoticed.
+var DefaultIdempotentMethods = []string{
+	"system.listMethods",
+	"system.client_version",
+	"system.api_version",
+	"system.hostname",
+	"system.pid",
+	"system.time*",
+	"d.multicall2",
+	"f.multicall",
+	"p.multicall",
+	"t.multicall",
+	"d.name",
+	"d.hash",
+	"d.base_path",
+	"d.directory",
+	"d.directory_base",
+	"d.size_bytes",
+	"d.completed_bytes",
+	"d.bytes_done",
+	"d.left_bytes",
+	"d.complete",
+	"d.is_*",
+	"d.state",
+	"d.ratio",
+	"d.custom",
+	"d.custom[1-5]",
+	"d.priority",
+	"d.message",
+	"d.creation_date",
+	"d.timestamp.*",
+	"d.down.rate",
+	"d.down.total",
+	"d.up.rate",
+	"d.up.total",
+	"f.path",
+	"f.size_bytes",
+	"f.priority",
+	"f.is_*",
+	"throttle.*.rate",
+	"throttle.*.total",
+	"throttle.*.max_rate",
+	"network.bind_address",
+	"network.listen.port",
+	"directory.default",
+	"session.path",
+	"view.list",
+	"download_list",
+}
+
+// MutatingCommands are the patterns, in path.Match syntax, of commands which make a call of d.multicall2,
+// f.multicall, p.multicall or t.multicall unsafe to retry
+var MutatingCommands = []string{
+	"*.set",
+	"d.erase",
+	"d.start",
+	"d.stop",
+	"d.open",
+	"d.close",
+	"d.pause",
+	"d.resume",
+	"d.check_hash",
+	"d.save_*",
+	"d.delete_*",
+	"d.create_link",
+	"d.tracker_announce",
+	"d.views.push_back*",
+	"d.views.remove",
+	"f.set_*",
+	"t.disable",
+	"t.enable",
+	"p.disconnect*",
+	"load.*",
+	"execute*",
+	"method.*",
+	"schedule*",
+	"session.save",
+	"view.*",
+}
+
+// WithRetry retries failed calls of idempotent methods according to policy
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = &policy
+	}
+}
+
+// WithIdempotentMethods marks additional methods as safe to retry, in addition to DefaultIdempotentMethods.
+// Patterns use path.Match syntax, e.g. "load.*" or "d.erase".
+func WithIdempotentMethods(patterns ...string) Option {
+	return func(c *Client) {
+		c.idempotent = append(c.idempotent, patterns...)
+	}
+}
+
+// DefaultRetryable reports whether err is a transient failure worth retrying:
+// network errors such as refused or reset connections, and 429, 502, 503 and 504 responses.
+// Faults, cancelled contexts and malformed responses are not retried.
+func DefaultRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var fault *Fault
+	if errors.As(err, &fault) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// withDefaults fills the zero fields of p from DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Multiplier <= 0 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.Retryable == nil {
+		p.Retryable = DefaultRetryable
+	}
+	return p
+}
+
+// Backoff returns the delay before the given retry, starting at 1 for the delay after the first attempt
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	p = p.withDefaults()
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// do calls fn until it succeeds, fails with an error which isn't retryable or the attempts are exhausted
+func (p RetryPolicy) do(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	p = p.withDefaults()
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.Retryable(err) {
+			if err != nil && attempt > 1 {
+				err = errors.Wrapf(err, "giving up after %d attempts", attempt)
+			}
+			return result, err
+		}
+
+		timer := time.NewTimer(p.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isIdempotent reports whether a call of method name with args may safely be sent more than once.
+// A system.multicall is idempotent if all of its calls are.
+func (c *Client) isIdempotent(name string, args []interface{}) bool {
+	if name != "system.multicall" {
+		return c.matchIdempotent(name) && !(isCommandMulticall(name) && c.mutates(name, args))
+	}
+	var calls []struct {
+		MethodName string        `xmlrpc:"methodName"`
+		Params     []interface{} `xmlrpc:"params"`
+	}
+	if len(args) != 1 || Decode(args[0], &calls) != nil {
+		return false
+	}
+	for _, call := range calls {
+		if call.MethodName == "system.multicall" || !c.isIdempotent(call.MethodName, call.Params) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCommandMulticall reports whether method name runs the commands passed as its arguments on each item
+func isCommandMulticall(name string) bool {
+	switch name {
+	case "d.multicall2", "d.multicall.filtered", "f.multicall", "p.multicall", "t.multicall":
+		return true
+	}
+	return false
+}
+
+// mutates reports whether the commands passed to the multicall method name include a mutating one,
+// which is fine only if the whole call was marked safe with WithIdempotentMethods
+func (c *Client) mutates(name string, args []interface{}) bool {
+	for _, pattern := range c.idempotent {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	for _, arg := range args {
+		command, ok := arg.(string)
+		if !ok {
+			continue
+		}
+		if i := strings.IndexByte(command, '='); i >= 0 {
+			command = command[:i]
+		}
+		for _, pattern := range MutatingCommands {
+			if ok, _ := path.Match(pattern, command); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Client) matchIdempotent(name string) bool {
+	sets := [][]string{DefaultIdempotentMethods, c.idempotent}
+	if strings.HasSuffix(name, ".set") {
+		// only setters marked safe explicitly are retried
+		sets = sets[1:]
+	}
+	for _, patterns := range sets {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
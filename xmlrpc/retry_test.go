@@ -0,0 +1,243 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// newFlakyServer starts a server which fails the first `failures` requests with fail and answers the rest
+func newFlakyServer(t *testing.T, failures int32, fail func(w http.ResponseWriter)) (*httptest.Server, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			fail(w)
+			return
+		}
+		name, _, _, err := Unmarshal(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "text/xml")
+		require.NoError(t, Marshal(w, "", "called "+name))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// dropConnection closes the connection without answering, like rTorrent while it is busy
+func dropConnection(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func unavailable(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestRetry(t *testing.T) {
+	t.Run("dropped connections", func(t *testing.T) {
+		srv, requests := newFlakyServer(t, 2, dropConnection)
+		result, err := NewClient(srv.URL, false, WithRetry(fastRetry)).Call("d.name", "ABC")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"called d.name"}, result)
+		require.EqualValues(t, 3, atomic.LoadInt32(requests))
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		srv, requests := newFlakyServer(t, 5, unavailable)
+		_, err := NewClient(srv.URL, false, WithRetry(fastRetry)).Call("throttle.global_down.rate")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "giving up after 3 attempts")
+		var httpErr *HTTPError
+		require.True(t, errors.As(err, &httpErr), "unexpected error: %v", err)
+		require.EqualValues(t, 3, atomic.LoadInt32(requests))
+	})
+
+	t.Run("without policy", func(t *testing.T) {
+		srv, requests := newFlakyServer(t, 1, dropConnection)
+		_, err := NewClient(srv.URL, false).Call("d.name", "ABC")
+		require.Error(t, err)
+		require.EqualValues(t, 1, atomic.LoadInt32(requests))
+	})
+
+	t.Run("mutating methods", func(t *testing.T) {
+		srv, requests := newFlakyServer(t, 1, dropConnection)
+		_, err := NewClient(srv.URL, false, WithRetry(fastRetry)).Call("d.erase", "ABC")
+		require.Error(t, err)
+		require.EqualValues(t, 1, atomic.LoadInt32(requests))
+
+		srv, requests = newFlakyServer(t, 1, dropConnection)
+		client := NewClient(srv.URL, false, WithRetry(fastRetry), WithIdempotentMethods("load.*"))
+		_, err = client.Call("load.start", "", "http://example.com/a.torrent")
+		require.NoError(t, err)
+		require.EqualValues(t, 2, atomic.LoadInt32(requests))
+
+		srv, requests = newFlakyServer(t, 1, dropConnection)
+		_, err = NewClient(srv.URL, false, WithRetry(fastRetry)).Call("d.down.choke_heuristics.set", "ABC", "leech_base")
+		require.Error(t, err)
+		require.EqualValues(t, 1, atomic.LoadInt32(requests))
+	})
+
+	t.Run("multicall", func(t *testing.T) {
+		srv, requests := newFlakyServer(t, 1, dropConnection)
+		client := NewClient(srv.URL, false, WithRetry(fastRetry))
+		_, err := client.NewBatch().Add("d.name", "ABC").Add("d.start", "ABC").Run()
+		require.Error(t, err)
+		require.EqualValues(t, 1, atomic.LoadInt32(requests))
+
+		srv, requests = newFlakyServer(t, 1, dropConnection)
+		client = NewClient(srv.URL, false, WithRetry(fastRetry))
+		_, err = client.CallContext(context.Background(), "system.multicall", []interface{}{
+			map[string]interface{}{"methodName": "d.name", "params": []interface{}{"ABC"}},
+			map[string]interface{}{"methodName": "d.size_bytes", "params": []interface{}{"ABC"}},
+		})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, atomic.LoadInt32(requests))
+	})
+
+	t.Run("faults are not retried", func(t *testing.T) {
+		var requests int32
+		srv := newTestServer(t, func(name string, params []interface{}) interface{} {
+			atomic.AddInt32(&requests, 1)
+			return &Fault{Code: -501, Message: "Could not find info-hash."}
+		})
+		_, err := NewClient(srv.URL, false, WithRetry(fastRetry)).Call("d.name", "ABC")
+		require.Error(t, err)
+		require.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		srv, requests := newFlakyServer(t, 5, unavailable)
+		policy := fastRetry
+		policy.Retryable = func(err error) bool { return false }
+		_, err := NewClient(srv.URL, false, WithRetry(policy)).Call("d.name", "ABC")
+		require.Error(t, err)
+		require.EqualValues(t, 1, atomic.LoadInt32(requests))
+	})
+
+	t.Run("context cancelled during backoff", func(t *testing.T) {
+		srv, _ := newFlakyServer(t, 5, unavailable)
+		policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := NewClient(srv.URL, false, WithRetry(policy)).CallContext(ctx, "d.name", "ABC")
+		require.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	})
+}
+
+func TestRetryCallEach(t *testing.T) {
+	var rows bytes.Buffer
+	require.NoError(t, Marshal(&rows, "", []interface{}{[]interface{}{"A"}, []interface{}{"B"}}))
+	response := rows.Bytes()
+
+	t.Run("before the first element", func(t *testing.T) {
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) <= 2 {
+				unavailable(w)
+				return
+			}
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write(response)
+		}))
+		defer srv.Close()
+
+		var elems []interface{}
+		client := NewClient(srv.URL, false, WithRetry(fastRetry))
+		require.NoError(t, client.CallEach(context.Background(), "d.multicall2", []interface{}{"", "main", "d.hash="}, collect(&elems)))
+		require.Equal(t, []interface{}{[]interface{}{"A"}, []interface{}{"B"}}, elems)
+		require.EqualValues(t, 3, atomic.LoadInt32(&requests))
+
+		atomic.StoreInt32(&requests, 0)
+		err := client.CallEach(context.Background(), "d.start", []interface{}{"ABC"}, collect(&elems))
+		require.Error(t, err)
+		require.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+
+	t.Run("after the first element", func(t *testing.T) {
+		// the response is cut off within the second row
+		cut := bytes.Index(response, []byte("<string>B"))
+		var requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Content-Type", "text/xml")
+			w.Header().Set("Content-Length", strconv.Itoa(len(response)))
+			w.Write(response[:cut])
+		}))
+		defer srv.Close()
+
+		var elems []interface{}
+		err := NewClient(srv.URL, false, WithRetry(fastRetry)).CallEach(context.Background(), "d.multicall2", []interface{}{"", "main", "d.hash="}, collect(&elems))
+		require.Error(t, err)
+		require.Equal(t, []interface{}{[]interface{}{"A"}}, elems)
+		require.EqualValues(t, 1, atomic.LoadInt32(&requests))
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	require.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	require.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	require.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	require.Equal(t, time.Second, policy.Backoff(10))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := policy.Backoff(1)
+		require.True(t, d >= 50*time.Millisecond && d <= 150*time.Millisecond, "backoff out of range: %v", d)
+	}
+}
+
+func TestDefaultRetryable(t *testing.T) {
+	require.False(t, DefaultRetryable(nil))
+	require.False(t, DefaultRetryable(&Fault{Code: -501}))
+	require.False(t, DefaultRetryable(errors.Wrap(context.Canceled, "POST failed")))
+	require.False(t, DefaultRetryable(&HTTPError{StatusCode: http.StatusUnauthorized}))
+	require.False(t, DefaultRetryable(&ContentTypeError{ContentType: "text/html"}))
+	require.True(t, DefaultRetryable(&HTTPError{StatusCode: http.StatusBadGateway}))
+	require.True(t, DefaultRetryable(errors.Wrap(io.ErrUnexpectedEOF, "POST failed")))
+}
+
+func TestIdempotentMethods(t *testing.T) {
+	c := NewClient("http://localhost", false, WithIdempotentMethods("d.erase"))
+	for _, name := range []string{"d.name", "d.multicall2", "throttle.global_down.rate", "d.custom1", "d.is_open", "d.down.rate", "d.up.total", "d.erase"} {
+		require.True(t, c.isIdempotent(name, nil), name)
+	}
+	for _, name := range []string{"load.start", "d.start", "d.custom1.set", "throttle.global_down.max_rate.set",
+		"d.down.choke_heuristics.set", "d.up.choke_heuristics.set", "d.timestamp.finished.set", "d.is_open.set"} {
+		require.False(t, c.isIdempotent(name, nil), name)
+	}
+	require.False(t, c.isIdempotent("system.multicall", []interface{}{"bogus"}))
+
+	// multicalls running mutating commands
+	for _, args := range [][]interface{}{
+		{"", "main", "d.hash=", "d.erase="},
+		{"", "main", "d.hash=", "d.custom1.set=label"},
+		{"ABC", "", "f.priority.set=0"},
+		{"", "main", "execute.throw=rm"},
+	} {
+		require.False(t, c.isIdempotent("d.multicall2", args), "%v", args)
+	}
+	require.True(t, c.isIdempotent("d.multicall2", []interface{}{"", "main", "d.hash=", "d.custom=tag", "d.peers_connected="}))
+	require.False(t, c.isIdempotent("system.multicall", []interface{}{[]interface{}{
+		map[string]interface{}{"methodName": "d.name", "params": []interface{}{"ABC"}},
+		map[string]interface{}{"methodName": "d.multicall2", "params": []interface{}{"", "main", "d.stop="}},
+	}}))
+	require.True(t, NewClient("http://localhost", false, WithIdempotentMethods("d.multicall2")).isIdempotent("d.multicall2", []interface{}{"", "main", "d.erase="}))
+
+	c = NewClient("http://localhost", false, WithIdempotentMethods("d.custom1.set"))
+	require.True(t, c.isIdempotent("d.custom1.set", nil))
+	require.False(t, c.isIdempotent("d.custom2.set", nil))
+}
@@ -0,0 +1,239 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SCGIScheme is the URL scheme used to address an SCGI endpoint.
+// Use scgi://host:port for TCP or scgi:///path/to.sock for a Unix socket.
+const SCGIScheme = "scgi"
+
+// SCGITransport is an http.RoundTripper which speaks SCGI, the protocol used by
+// rTorrent's built-in RPC listener (network.scgi.open_port / network.scgi.open_local).
+// It allows a Client to talk to rTorrent directly, without a web server in front.
+type SCGITransport struct {
+	// Network is the network to dial, "tcp" or "unix".
+	// If empty, it is derived from the request URL.
+	Network string
+	// Address is the address to dial, host:port for TCP or a socket path for Unix.
+	// If empty, it is derived from the request URL.
+	Address string
+	// Dialer is used to establish connections, a zero net.Dialer is used if nil.
+	Dialer *net.Dialer
+}
+
+// NewSCGITransport returns a new SCGITransport which dials the given network and address
+func NewSCGITransport(network, address string) *SCGITransport {
+	return &SCGITransport{
+		Network: network,
+		Address: address,
+	}
+}
+
+// scgiEndpoint returns the network and address to dial for the given URL
+func scgiEndpoint(u *url.URL) (network, address string, err error) {
+	if u.Host != "" {
+		return "tcp", u.Host, nil
+	}
+	if u.Path != "" {
+		return "unix", u.Path, nil
+	}
+	return "", "", errors.Errorf("no SCGI address in %q", u.String())
+}
+
+func (t *SCGITransport) endpoint(req *http.Request) (network, address string, err error) {
+	if t.Network != "" && t.Address != "" {
+		return t.Network, t.Address, nil
+	}
+	return scgiEndpoint(req.URL)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *SCGITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	network, address, err := t.endpoint(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read request body")
+		}
+	}
+
+	dialer := t.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	conn, err := dialer.DialContext(req.Context(), network, address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial %s %s", network, address)
+	}
+
+	// rTorrent may stall for a long time (e.g. during large hash checks), so make sure
+	// a cancelled context unblocks any pending read or write on the connection
+	ctx := req.Context()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sc := &scgiConn{Conn: conn, done: make(chan struct{})}
+	go sc.watch(ctx)
+
+	if _, err := conn.Write(scgiRequest(req, body)); err != nil {
+		sc.Close()
+		return nil, contextErr(ctx, errors.Wrap(err, "failed to write SCGI request"))
+	}
+
+	resp, err := readSCGIResponse(bufio.NewReader(conn), sc)
+	if err != nil {
+		sc.Close()
+		return nil, contextErr(ctx, err)
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// contextErr prefers the context error over err once the context is done
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// scgiConn closes the connection when the context is done before the exchange finished
+type scgiConn struct {
+	net.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+func (c *scgiConn) watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		c.Conn.Close()
+	case <-c.done:
+	}
+}
+
+func (c *scgiConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+// scgiRequest encodes the request headers as a netstring followed by the body.
+// CONTENT_LENGTH must be the first header and the SCGI header must be present.
+func scgiRequest(req *http.Request, body []byte) []byte {
+	method := req.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	uri := req.URL.RequestURI()
+	if req.URL.Host == "" {
+		// Unix socket endpoints carry the socket path, not a request path
+		uri = "/"
+	}
+	headers := [][2]string{
+		{"CONTENT_LENGTH", strconv.Itoa(len(body))},
+		{"SCGI", "1"},
+		{"REQUEST_METHOD", method},
+		{"REQUEST_URI", uri},
+		{"SERVER_PROTOCOL", "HTTP/1.1"},
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers = append(headers, [2]string{"CONTENT_TYPE", ct})
+	}
+
+	var h bytes.Buffer
+	for _, kv := range headers {
+		h.WriteString(kv[0])
+		h.WriteByte(0)
+		h.WriteString(kv[1])
+		h.WriteByte(0)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d:", h.Len())
+	h.WriteTo(&b)
+	b.WriteByte(',')
+	b.Write(body)
+	return b.Bytes()
+}
+
+// readSCGIResponse reads a CGI style response ("Status: 200 OK" header block followed by the body).
+// Servers which reply with a full HTTP status line are handled as well.
+func readSCGIResponse(br *bufio.Reader, conn io.Closer) (*http.Response, error) {
+	peek, err := br.Peek(5)
+	if err != nil && len(peek) == 0 {
+		return nil, errors.Wrap(err, "failed to read SCGI response")
+	}
+	if string(peek) == "HTTP/" {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read SCGI response")
+		}
+		resp.Body = &scgiBody{Reader: resp.Body, conn: conn}
+		return resp, nil
+	}
+
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read SCGI response headers")
+	}
+	resp := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        http.Header(header),
+		ContentLength: -1,
+	}
+	if status := header.Get("Status"); status != "" {
+		code, err := strconv.Atoi(strings.SplitN(status, " ", 2)[0])
+		if err != nil {
+			return nil, errors.Errorf("invalid SCGI status %q", status)
+		}
+		resp.Status = status
+		resp.StatusCode = code
+		resp.Header.Del("Status")
+	}
+
+	var body io.Reader = br
+	if cl := header.Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid SCGI content length %q", cl)
+		}
+		resp.ContentLength = n
+		body = io.LimitReader(br, n)
+	}
+	resp.Body = &scgiBody{Reader: body, conn: conn}
+	return resp, nil
+}
+
+// scgiBody closes the underlying connection once the response body is closed
+type scgiBody struct {
+	io.Reader
+	conn io.Closer
+}
+
+func (b *scgiBody) Close() error {
+	return b.conn.Close()
+}
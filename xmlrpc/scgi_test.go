@@ -0,0 +1,143 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scgiServer is a minimal in-process SCGI server which echoes the method name and params
+type scgiServer struct {
+	listener net.Listener
+	headers  chan map[string]string
+}
+
+func newSCGIServer(t *testing.T, network, address string) *scgiServer {
+	l, err := net.Listen(network, address)
+	require.NoError(t, err)
+	s := &scgiServer{listener: l, headers: make(chan map[string]string, 16)}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *scgiServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *scgiServer) handle(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	lenStr, err := br.ReadString(':')
+	if err != nil {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(lenStr, ":"))
+	if err != nil {
+		return
+	}
+	raw := make([]byte, n+1)
+	if _, err := io.ReadFull(br, raw); err != nil || raw[n] != ',' {
+		return
+	}
+	fields := strings.Split(string(raw[:n]), "\x00")
+	headers := map[string]string{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		headers[fields[i]] = fields[i+1]
+	}
+	s.headers <- headers
+
+	cl, _ := strconv.Atoi(headers["CONTENT_LENGTH"])
+	body := make([]byte, cl)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return
+	}
+
+	resp := bytes.NewBuffer(nil)
+	name, params, _, err := Unmarshal(bytes.NewReader(body))
+	if err != nil {
+		Marshal(resp, "", Fault{Code: -503, Message: err.Error()})
+	} else if name == "fail" {
+		Marshal(resp, "", Fault{Code: -501, Message: "Could not find info-hash."})
+	} else {
+		Marshal(resp, "", append([]interface{}{name}, params...))
+	}
+	fmt.Fprintf(conn, "Status: 200 OK\r\nContent-Type: text/xml\r\nContent-Length: %d\r\n\r\n", resp.Len())
+	resp.WriteTo(conn)
+}
+
+func TestSCGI(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		srv := newSCGIServer(t, "tcp", "127.0.0.1:0")
+		client := NewClient("scgi://"+srv.listener.Addr().String(), false)
+
+		result, err := client.Call("d.name", "ABCDEF", 42)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{[]interface{}{"d.name", "ABCDEF", 42}}, result)
+
+		headers := <-srv.headers
+		require.Equal(t, "1", headers["SCGI"])
+		require.Equal(t, "POST", headers["REQUEST_METHOD"])
+		require.Equal(t, "text/xml", headers["CONTENT_TYPE"])
+		require.NotEmpty(t, headers["CONTENT_LENGTH"])
+	})
+
+	t.Run("unix socket", func(t *testing.T) {
+		sock := filepath.Join(t.TempDir(), "rtorrent.sock")
+		srv := newSCGIServer(t, "unix", sock)
+		client := NewClient("scgi://"+sock, false)
+
+		result, err := client.Call("system.hostname")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{[]interface{}{"system.hostname"}}, result)
+		<-srv.headers
+	})
+
+	t.Run("explicit transport", func(t *testing.T) {
+		sock := filepath.Join(t.TempDir(), "rtorrent.sock")
+		srv := newSCGIServer(t, "unix", sock)
+		client := NewClientWithHTTPClient("http://rtorrent/RPC2", &http.Client{Transport: NewSCGITransport("unix", sock)})
+
+		result, err := client.Call("system.hostname")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{[]interface{}{"system.hostname"}}, result)
+		headers := <-srv.headers
+		require.Equal(t, "/RPC2", headers["REQUEST_URI"])
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		srv := newSCGIServer(t, "tcp", "127.0.0.1:0")
+		client := NewClient("scgi://"+srv.listener.Addr().String(), false)
+
+		_, err := client.Call("fail")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "Could not find info-hash.")
+	})
+
+	t.Run("connection refused", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := l.Addr().String()
+		l.Close()
+
+		client := NewClient("scgi://"+addr, false)
+		_, err = client.Call("system.hostname")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "POST failed")
+	})
+}
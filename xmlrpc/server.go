@@ -0,0 +1,278 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Fault codes from the specification for fault code interoperability, used by Server
+const (
+	// FaultParseError is returned when the request is not well formed
+	FaultParseError = -32700
+	// FaultMethodNotFound is returned when the requested method is not registered
+	FaultMethodNotFound = -32601
+	// FaultInvalidParams is returned when the params do not fit the registered function
+	FaultInvalidParams = -32602
+	// FaultInternalError is returned when a method fails with an error which isn't a Fault
+	FaultInternalError = -32603
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Server is an http.Handler which serves XMLRPC methods.
+// It implements system.listMethods and system.multicall on top of the registered methods.
+// Requests with a JSON content type are served as JSON-RPC 2.0, like rTorrent 0.15 does.
+//
+// Example:
+//  srv := xmlrpc.NewServer()
+//  srv.Register("d.name", func(hash string) (string, error) { ... })
+//  http.Handle("/RPC2", srv)
+type Server struct {
+	// NotFound is called for methods which aren't registered, e.g. to forward them to another server.
+	// If nil, a FaultMethodNotFound fault is returned.
+	NotFound func(ctx context.Context, name string, params []interface{}) (interface{}, error)
+	// Limits bounds the resources spent on parsing requests, DefaultLimits if nil
+	Limits *Limits
+
+	mu      sync.RWMutex
+	methods map[string]*serverMethod
+}
+
+type serverMethod struct {
+	fn         reflect.Value
+	hasContext bool
+	params     []reflect.Type
+	variadic   bool
+	hasResult  bool
+	hasError   bool
+}
+
+// NewServer returns a new Server without any registered methods
+func NewServer() *Server {
+	return &Server{methods: map[string]*serverMethod{}}
+}
+
+// Register registers fn to serve the method with "name", replacing any previous registration.
+//
+// fn must be a function. It may take a context.Context as its first parameter, which carries the
+// context of the HTTP request; the remaining parameters are decoded from the call params with Decode.
+// A variadic final parameter receives all remaining params.
+// fn may return nothing, a result, an error or a result and an error. Errors are turned into faults,
+// a *Fault keeps its code while other errors are reported as FaultInternalError.
+// Methods without a result respond with 0, as rTorrent does.
+func (s *Server) Register(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return errors.Errorf("cannot register %s: %T is not a function", name, fn)
+	}
+	t := v.Type()
+	m := &serverMethod{fn: v, variadic: t.IsVariadic()}
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && t.In(i) == contextType {
+			m.hasContext = true
+			continue
+		}
+		m.params = append(m.params, t.In(i))
+	}
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		if t.Out(0) == errorType {
+			m.hasError = true
+		} else {
+			m.hasResult = true
+		}
+	case 2:
+		if t.Out(1) != errorType {
+			return errors.Errorf("cannot register %s: second result of %v must be an error", name, t)
+		}
+		m.hasResult, m.hasError = true, true
+	default:
+		return errors.Errorf("cannot register %s: %v has too many results", name, t)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[name] = m
+	return nil
+}
+
+func (s *Server) limits() Limits {
+	if s.Limits == nil {
+		return DefaultLimits
+	}
+	return *s.Limits
+}
+
+// Methods returns the names of all methods served, including the system methods
+func (s *Server) Methods() []string {
+	s.mu.RLock()
+	names := []string{"system.listMethods", "system.multicall"}
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "XMLRPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := requestBody(r)
+	if err != nil {
+		w.Header().Set("Accept-Encoding", "gzip")
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); strings.Contains(mediaType, "json") {
+		s.serveJSON(w, r, body)
+		return
+	}
+
+	var result interface{}
+	name, params, _, err := UnmarshalLimits(body, s.limits())
+	if err != nil {
+		result = &Fault{Code: FaultParseError, Message: err.Error()}
+	} else if result, err = s.Call(r.Context(), name, params...); err != nil {
+		result = toFault(err)
+	}
+
+	if result == nil {
+		result = 0
+	}
+	var b bytes.Buffer
+	if err := Marshal(&b, "", result); err != nil {
+		b.Reset()
+		Marshal(&b, "", &Fault{Code: FaultInternalError, Message: fmt.Sprintf("failed to marshal result of %s: %v", name, err)})
+	}
+	writeResponse(w, r, "text/xml", &b)
+}
+
+// Call dispatches a call of the method with "name" with the given params as if it was received by the server
+func (s *Server) Call(ctx context.Context, name string, params ...interface{}) (interface{}, error) {
+	switch name {
+	case "system.listMethods":
+		return s.Methods(), nil
+	case "system.multicall":
+		return s.multicall(ctx, params)
+	}
+
+	s.mu.RLock()
+	m, ok := s.methods[name]
+	s.mu.RUnlock()
+	if !ok {
+		if s.NotFound != nil {
+			return s.NotFound(ctx, name, params)
+		}
+		return nil, &Fault{Code: FaultMethodNotFound, Message: fmt.Sprintf("method %s not found", name)}
+	}
+	return m.call(ctx, name, params)
+}
+
+func (m *serverMethod) call(ctx context.Context, name string, params []interface{}) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, &Fault{Code: FaultInternalError, Message: fmt.Sprintf("%s panicked: %v", name, r)}
+		}
+	}()
+
+	fixed := len(m.params)
+	if m.variadic {
+		fixed--
+	}
+	if len(params) < fixed || (!m.variadic && len(params) > fixed) {
+		return nil, &Fault{Code: FaultInvalidParams, Message: fmt.Sprintf("%s expects %d params, got %d", name, fixed, len(params))}
+	}
+
+	var in []reflect.Value
+	if m.hasContext {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	for i, param := range params {
+		var typ reflect.Type
+		if i < fixed {
+			typ = m.params[i]
+		} else {
+			typ = m.params[len(m.params)-1].Elem()
+		}
+		arg := reflect.New(typ)
+		if err := Decode(param, arg.Interface()); err != nil {
+			return nil, &Fault{Code: FaultInvalidParams, Message: fmt.Sprintf("%s param %d: %v", name, i, err)}
+		}
+		in = append(in, arg.Elem())
+	}
+
+	out := m.fn.Call(in)
+	result = 0
+	if m.hasResult {
+		if v := out[0]; (v.Kind() != reflect.Interface && v.Kind() != reflect.Ptr) || !v.IsNil() {
+			result = v.Interface()
+		}
+	}
+	if m.hasError {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) multicall(ctx context.Context, params []interface{}) (interface{}, error) {
+	var calls []struct {
+		MethodName string        `xmlrpc:"methodName"`
+		Params     []interface{} `xmlrpc:"params"`
+	}
+	if len(params) != 1 {
+		return nil, &Fault{Code: FaultInvalidParams, Message: "system.multicall expects an array of calls"}
+	}
+	if err := Decode(params[0], &calls); err != nil {
+		return nil, &Fault{Code: FaultInvalidParams, Message: fmt.Sprintf("system.multicall: %v", err)}
+	}
+
+	results := make([]interface{}, len(calls))
+	for i, call := range calls {
+		var result interface{}
+		var err error
+		if call.MethodName == "system.multicall" {
+			err = &Fault{Code: FaultInvalidParams, Message: "system.multicall cannot be nested"}
+		} else {
+			result, err = s.Call(ctx, call.MethodName, call.Params...)
+		}
+		if err != nil {
+			f := toFault(err)
+			results[i] = map[string]interface{}{"faultCode": f.Code, "faultString": f.Message}
+			continue
+		}
+		if result == nil {
+			result = 0
+		}
+		results[i] = []interface{}{result}
+	}
+	return results, nil
+}
+
+// toFault converts err into a Fault, keeping the code of a wrapped *Fault
+func toFault(err error) *Fault {
+	var fault *Fault
+	if errors.As(err, &fault) {
+		return fault
+	}
+	return &Fault{Code: FaultInternalError, Message: err.Error()}
+}
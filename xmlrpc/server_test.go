@@ -0,0 +1,137 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	require.NoError(t, srv.Register("d.name", func(hash string) (string, error) {
+		if hash != "ABC" {
+			return "", &Fault{Code: -501, Message: "Could not find info-hash."}
+		}
+		return "name-of-" + hash, nil
+	}))
+	require.NoError(t, srv.Register("d.sum", func(ctx context.Context, values ...int) int {
+		require.NotNil(t, ctx)
+		sum := 0
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	}))
+	require.NoError(t, srv.Register("d.row", func(row struct {
+		Name string `xmlrpc:"name"`
+		Size int    `xmlrpc:"size"`
+	}) []interface{} {
+		return []interface{}{row.Name, row.Size}
+	}))
+	require.NoError(t, srv.Register("d.fail", func() error {
+		return errors.New("something broke")
+	}))
+	require.NoError(t, srv.Register("d.start", func(hash string) {}))
+	require.Error(t, srv.Register("bogus", "not a function"))
+	require.Error(t, srv.Register("bogus", func() (int, int) { return 0, 0 }))
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	client := NewClient(ts.URL, false)
+
+	t.Run("call", func(t *testing.T) {
+		result, err := client.Call("d.name", "ABC")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"name-of-ABC"}, result)
+
+		result, err = client.Call("d.sum", 1, 2, 3)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{6}, result)
+
+		result, err = client.Call("d.row", map[string]interface{}{"name": "a", "size": 1})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{[]interface{}{"a", 1}}, result)
+
+		result, err = client.Call("d.start", "ABC")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{0}, result)
+	})
+
+	t.Run("faults", func(t *testing.T) {
+		_, err := client.Call("d.name", "XYZ")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "-501: Could not find info-hash.")
+
+		_, err = client.Call("d.fail")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "-32603: something broke")
+
+		_, err = client.Call("d.missing")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "-32601")
+
+		_, err = client.Call("d.name")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "-32602")
+
+		_, err = client.Call("d.name", 42)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "-32602")
+	})
+
+	t.Run("list methods", func(t *testing.T) {
+		result, err := client.Call("system.listMethods")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{[]interface{}{
+			"d.fail", "d.name", "d.row", "d.start", "d.sum", "system.listMethods", "system.multicall",
+		}}, result)
+	})
+
+	t.Run("multicall", func(t *testing.T) {
+		results, err := client.NewBatch().
+			Add("d.name", "ABC").
+			Add("d.name", "XYZ").
+			Add("d.sum", 40, 2).
+			Add("system.multicall").
+			Run()
+		require.NoError(t, err)
+		require.Len(t, results, 4)
+		require.Equal(t, "name-of-ABC", results[0].Value)
+		require.Equal(t, &Fault{Code: -501, Message: "Could not find info-hash."}, results[1].Err)
+		require.Equal(t, 42, results[2].Value)
+		require.Error(t, results[3].Err)
+	})
+
+	t.Run("not found handler", func(t *testing.T) {
+		srv := NewServer()
+		srv.NotFound = func(ctx context.Context, name string, params []interface{}) (interface{}, error) {
+			return "forwarded " + name, nil
+		}
+		ts := httptest.NewServer(srv)
+		defer ts.Close()
+
+		result, err := NewClient(ts.URL, false).Call("d.anything", "ABC")
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"forwarded d.anything"}, result)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		resp, err := http.Get(ts.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+		resp, err = http.Post(ts.URL, "text/xml", strings.NewReader("<html>"))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, _, fault, err := Unmarshal(resp.Body)
+		require.NoError(t, err)
+		require.NotNil(t, fault)
+		require.Equal(t, FaultParseError, fault.Code)
+	})
+}
@@ -0,0 +1,336 @@
+package xmlrpc
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+var arrayType = reflect.TypeOf([]interface{}{})
+
+// StreamCodec is implemented by codecs which can decode an array result one element at a time,
+// without holding the whole response in memory. XMLCodec and JSONCodec implement it.
+type StreamCodec interface {
+	Codec
+	// DecodeResponseEach reads a response from r whose single param is an array and calls fn with each element.
+	// An error returned by fn stops decoding and is returned as is, a fault is returned as a *Fault error.
+	// A response of another shape is reported as a *DecodeError.
+	DecodeResponseEach(r io.Reader, fn func(elem interface{}) error) error
+}
+
+// UnmarshalEach reads a methodResponse whose single param is an array and calls fn with each of its elements,
+// parsing the elements incrementally, so only a single element is held in memory at a time.
+// An error returned by fn stops parsing and is returned as is.
+// A fault response is returned as fault, a response of another shape as a *DecodeError.
+// DefaultLimits are enforced, exceeding them results in a *LimitError.
+func UnmarshalEach(r io.Reader, fn func(elem interface{}) error) (fault *Fault, e error) {
+	return UnmarshalEachLimits(r, DefaultLimits, fn)
+}
+
+// UnmarshalEachLimits is like UnmarshalEach but enforces the given limits
+func UnmarshalEachLimits(r io.Reader, limits Limits, fn func(elem interface{}) error) (fault *Fault, e error) {
+	st := newLimitedParser(r, limits)
+	if _, e = st.getStart("methodResponse"); e != nil {
+		return
+	}
+	var se xml.StartElement
+	if se, e = st.getStart("params"); e != nil {
+		if ErrEq(e, errNameMismatch) && se.Name.Local == "fault" {
+			fault, e = st.parseFault()
+		}
+		return
+	}
+	if _, e = st.getStart("param"); e != nil {
+		if ErrEq(e, errNotStartElement) {
+			e = &DecodeError{Type: arrayType, Reason: "response has no params"}
+		}
+		return
+	}
+	if _, e = st.getStart("value"); e != nil {
+		return
+	}
+
+	// anything but an array is parsed as a whole for the error
+	if se, e = st.getStart(""); e != nil {
+		return
+	}
+	if se.Name.Local != "array" {
+		var t xml.Token = se
+		st.last = &t
+		var v interface{}
+		if v, e = st.parseValue(); e == nil {
+			e = &DecodeError{Value: v, Type: arrayType}
+		}
+		return
+	}
+	if e = st.enter(); e != nil {
+		return
+	}
+	if _, e = st.getStart("data"); e != nil {
+		return
+	}
+	for i := 1; ; i++ {
+		if _, e = st.getStart("value"); e != nil {
+			if ErrEq(e, errNotStartElement) {
+				break
+			}
+			return
+		}
+		if e = st.limits.checkLength(i); e != nil {
+			return
+		}
+		var v interface{}
+		if v, e = st.parseValue(); e != nil {
+			return
+		}
+		if e = st.checkLast("value"); e != nil {
+			return
+		}
+		if e = fn(v); e != nil {
+			return
+		}
+	}
+
+	for _, name := range []string{"data", "array", "value", "param"} {
+		if e = st.checkLast(name); e != nil {
+			return
+		}
+	}
+	if e = st.checkLast("params"); e != nil {
+		if ErrEq(e, errNotEndElement) {
+			e = &DecodeError{Type: arrayType, Reason: "response has more than one param"}
+		}
+		return
+	}
+	e = st.checkLast("methodResponse")
+	return
+}
+
+func (c xmlCodec) DecodeResponseEach(r io.Reader, fn func(elem interface{}) error) error {
+	return c.decodeResponseEach(r, DefaultLimits, nil, fn)
+}
+
+func (xmlCodec) decodeResponseEach(r io.Reader, limits Limits, _ json.RawMessage, fn func(elem interface{}) error) error {
+	fault, err := UnmarshalEachLimits(r, limits, fn)
+	if fault != nil {
+		return fault
+	}
+	return err
+}
+
+func (c *jsonCodec) DecodeResponseEach(r io.Reader, fn func(elem interface{}) error) error {
+	return c.decodeResponseEach(r, DefaultLimits, nil, fn)
+}
+
+// decodeResponseEach streams the result of a response. As the id may follow the result,
+// fn may have been called when a mismatched id is detected.
+func (*jsonCodec) decodeResponseEach(r io.Reader, limits Limits, id json.RawMessage, fn func(elem interface{}) error) error {
+	dec := json.NewDecoder(limitReader(r, limits.MaxResponseBytes))
+	dec.UseNumber()
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	sawResult := false
+	var fault *Fault
+	var gotID json.RawMessage
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return errors.Wrap(err, "failed to decode JSON-RPC response")
+		}
+		switch t {
+		case "error":
+			var jsonErr *jsonError
+			if err := dec.Decode(&jsonErr); err != nil {
+				return errors.Wrap(err, "failed to decode JSON-RPC error")
+			}
+			if jsonErr != nil {
+				fault = &Fault{Code: jsonErr.Code, Message: jsonErr.Message}
+			}
+		case "id":
+			if err := dec.Decode(&gotID); err != nil {
+				return errors.Wrap(err, "failed to decode JSON-RPC response")
+			}
+			// a mismatched id before the result keeps fn from being called at all
+			if err := checkID(id, gotID, true); err != nil {
+				return err
+			}
+		case "result":
+			sawResult = true
+			if err := decodeJSONEach(dec, limits, fn); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return errors.Wrap(err, "failed to decode JSON-RPC response")
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+	if err := checkID(id, gotID, fault != nil); err != nil {
+		return err
+	}
+	if fault != nil {
+		return fault
+	}
+	if !sawResult {
+		return errors.New("JSON-RPC response has neither result nor error")
+	}
+	return nil
+}
+
+// decodeJSONEach decodes the array at the current position of dec, calling fn with each element
+func decodeJSONEach(dec *json.Decoder, limits Limits, fn func(elem interface{}) error) error {
+	if !dec.More() {
+		return errors.New("JSON-RPC response ends before result")
+	}
+	t, err := dec.Token()
+	if err != nil {
+		return errors.Wrap(err, "failed to decode JSON-RPC result")
+	}
+	if t != json.Delim('[') {
+		// anything but an array is decoded as a whole for the error
+		var v interface{} = t
+		if d, ok := t.(json.Delim); ok && d == '{' {
+			m := map[string]interface{}{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return errors.Wrap(err, "failed to decode JSON-RPC result")
+				}
+				var value interface{}
+				if err := dec.Decode(&value); err != nil {
+					return errors.Wrap(err, "failed to decode JSON-RPC result")
+				}
+				m[fmt.Sprint(key)] = value
+			}
+			dec.Token()
+			v = m
+		}
+		return &DecodeError{Value: fromJSONValue(v), Type: arrayType}
+	}
+	for i := 1; dec.More(); i++ {
+		if err := limits.enter(1, i); err != nil {
+			return err
+		}
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return errors.Wrap(err, "failed to decode JSON-RPC result")
+		}
+		v = fromJSONValue(v)
+		if err := limits.checkDepth(v, 1); err != nil {
+			return err
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return errors.Wrap(err, "failed to decode JSON-RPC response")
+	}
+	if t != delim {
+		return errors.Errorf("failed to decode JSON-RPC response: expected %v, found %v", delim, t)
+	}
+	return nil
+}
+
+// CallEach calls the method with "name" with the given args, which has to return an array, and calls fn with each
+// of its elements. The response is decoded incrementally if the codec is a StreamCodec, so only a single element
+// is held in memory at a time, which keeps huge responses like d.multicall2 on thousands of torrents cheap.
+//
+// An error returned by fn stops the call and is returned as is. A response which is not an array
+// is reported as a *DecodeError. Calls of idempotent methods are retried like those of CallContext,
+// but only as long as fn has not been called, so no element is ever passed to fn twice.
+// Interceptors see the call with a nil result.
+func (c *Client) CallEach(ctx context.Context, name string, args []interface{}, fn func(elem interface{}) error) error {
+	var fnErr error
+	called := false
+	each := func(elem interface{}) error {
+		called = true
+		fnErr = fn(elem)
+		return fnErr
+	}
+	attempt := func(ctx context.Context, name string, args []interface{}) (interface{}, error) {
+		codec, err := c.resolveCodec(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, id, err := c.post(ctx, codec, name, args)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		switch codec := codec.(type) {
+		case limitedCodec:
+			err = codec.decodeResponseEach(resp.Body, c.limits, id, each)
+		case StreamCodec:
+			err = codec.DecodeResponseEach(limitReader(resp.Body, c.limits.MaxResponseBytes), each)
+		default:
+			err = decodeEach(codec, limitReader(resp.Body, c.limits.MaxResponseBytes), c.limits, each)
+		}
+		var fault *Fault
+		var decodeErr *DecodeError
+		var limitErr *LimitError
+		if err != nil && err != fnErr && !errors.As(err, &fault) && !errors.As(err, &decodeErr) && !errors.As(err, &limitErr) && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, err
+	}
+	stream := func(ctx context.Context, name string, args []interface{}) (interface{}, error) {
+		if c.retry == nil || !c.isIdempotent(name, args) {
+			return attempt(ctx, name, args)
+		}
+		policy := c.retry.withDefaults()
+		retryable := policy.Retryable
+		policy.Retryable = func(err error) bool {
+			return !called && retryable(err)
+		}
+		_, err := policy.do(ctx, func() (interface{}, error) {
+			return attempt(ctx, name, args)
+		})
+		if fnErr != nil {
+			return nil, fnErr
+		}
+		return nil, err
+	}
+	_, err := chainInterceptors(c.interceptors, stream)(ctx, name, args)
+	return err
+}
+
+// decodeEach decodes a whole response with a codec which can't stream and calls fn with each element
+func decodeEach(codec Codec, r io.Reader, limits Limits, fn func(elem interface{}) error) error {
+	params, err := codec.DecodeResponse(r)
+	if err != nil {
+		return err
+	}
+	if err := limits.checkParams(params); err != nil {
+		return err
+	}
+	if len(params) != 1 {
+		return &DecodeError{Value: params, Type: arrayType, Reason: "expected a single param"}
+	}
+	elems, ok := params[0].([]interface{})
+	if !ok {
+		return &DecodeError{Value: params[0], Type: arrayType}
+	}
+	for _, elem := range elems {
+		if err := fn(elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// collect returns a callback appending the elements it is called with to elems
+func collect(elems *[]interface{}) func(interface{}) error {
+	return func(elem interface{}) error {
+		*elems = append(*elems, elem)
+		return nil
+	}
+}
+
+func TestUnmarshalEach(t *testing.T) {
+	marshal := func(params ...interface{}) io.Reader {
+		var b bytes.Buffer
+		require.NoError(t, Marshal(&b, "", params...))
+		return &b
+	}
+
+	t.Run("rows", func(t *testing.T) {
+		rows := []interface{}{
+			[]interface{}{"ABC", 1, true},
+			[]interface{}{"DEF", 2, false},
+			map[string]interface{}{"a": "b"},
+		}
+		var elems []interface{}
+		fault, err := UnmarshalEach(marshal(rows), collect(&elems))
+		require.NoError(t, err)
+		require.Nil(t, fault)
+		require.Equal(t, rows, elems)
+
+		elems = nil
+		_, err = UnmarshalEach(marshal([]interface{}{}), collect(&elems))
+		require.NoError(t, err)
+		require.Empty(t, elems)
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		fault, err := UnmarshalEach(marshal(&Fault{Code: -501, Message: "Could not find info-hash."}), collect(new([]interface{})))
+		require.NoError(t, err)
+		require.Equal(t, &Fault{Code: -501, Message: "Could not find info-hash."}, fault)
+	})
+
+	t.Run("unexpected shapes", func(t *testing.T) {
+		for _, params := range [][]interface{}{
+			{"not an array"},
+			{map[string]interface{}{"a": 1}},
+			{},
+			{[]interface{}{1}, []interface{}{2}},
+		} {
+			_, err := UnmarshalEach(marshal(params...), collect(new([]interface{})))
+			var decodeErr *DecodeError
+			require.True(t, errors.As(err, &decodeErr), "unexpected error for %v: %v", params, err)
+		}
+
+		_, err := UnmarshalEach(marshal("not an array"), collect(new([]interface{})))
+		require.Equal(t, "not an array", err.(*DecodeError).Value)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		_, err := UnmarshalEach(marshal([]interface{}{1, 2, 3}), func(elem interface{}) error {
+			calls++
+			return stop
+		})
+		require.Equal(t, stop, err)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := UnmarshalEach(strings.NewReader("<methodResponse><params><param><value><array><data><value><int>1</int></value>"), collect(new([]interface{})))
+		require.Error(t, err)
+	})
+}
+
+func TestJSONDecodeResponseEach(t *testing.T) {
+	codec := JSONCodec.(StreamCodec)
+
+	var elems []interface{}
+	err := codec.DecodeResponseEach(strings.NewReader(`{"jsonrpc":"2.0","id":1,"result":[["ABC",1,1.5],{"a":[true]}]}`), collect(&elems))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{[]interface{}{"ABC", 1, 1.5}, map[string]interface{}{"a": []interface{}{true}}}, elems)
+
+	err = codec.DecodeResponseEach(strings.NewReader(`{"jsonrpc":"2.0","id":1,"error":{"code":-501,"message":"Could not find info-hash."}}`), collect(&elems))
+	require.Equal(t, &Fault{Code: -501, Message: "Could not find info-hash."}, err)
+
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"result":"not an array"}`,
+		`{"jsonrpc":"2.0","id":1,"result":{"a":1}}`,
+	} {
+		err = codec.DecodeResponseEach(strings.NewReader(body), collect(&elems))
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr), "unexpected error for %s: %v", body, err)
+	}
+	require.Equal(t, map[string]interface{}{"a": 1}, err.(*DecodeError).Value)
+
+	require.Error(t, codec.DecodeResponseEach(strings.NewReader(`{"jsonrpc":"2.0","id":1}`), collect(&elems)))
+	require.Error(t, codec.DecodeResponseEach(strings.NewReader(`<methodResponse>`), collect(&elems)))
+}
+
+// plainCodec hides the StreamCodec implementation of a codec
+type plainCodec struct {
+	Codec
+}
+
+func TestCallEach(t *testing.T) {
+	srv := newCodecTestServer(t)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	args := []interface{}{"", "main", "d.hash="}
+	want, err := NewClient(ts.URL, false).Call("d.multicall2", args...)
+	require.NoError(t, err)
+
+	for _, codec := range []Codec{XMLCodec, JSONCodec, plainCodec{XMLCodec}} {
+		var intercepted []string
+		client := NewClient(ts.URL, false, WithCodec(codec), WithInterceptors(
+			func(ctx context.Context, method string, args []interface{}, next Invoker) (interface{}, error) {
+				intercepted = append(intercepted, method)
+				return next(ctx, method, args)
+			},
+		))
+
+		var elems []interface{}
+		require.NoError(t, client.CallEach(context.Background(), "d.multicall2", args, collect(&elems)))
+		require.Equal(t, want, []interface{}{elems})
+		require.Equal(t, []string{"d.multicall2"}, intercepted)
+
+		err := client.CallEach(context.Background(), "d.name", []interface{}{"ABC"}, collect(&elems))
+		var decodeErr *DecodeError
+		require.True(t, errors.As(err, &decodeErr), "unexpected error: %v", err)
+
+		err = client.CallEach(context.Background(), "d.name", []interface{}{"XYZ"}, collect(&elems))
+		var fault *Fault
+		require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+
+		stop := errors.New("stop")
+		err = client.CallEach(context.Background(), "d.multicall2", args, func(interface{}) error { return stop })
+		require.Equal(t, stop, err)
+	}
+}
+
+// multicallResponse returns a d.multicall2 response with n rows like GetTorrents requests
+func multicallResponse(n int) []byte {
+	rows := make([]interface{}, n)
+	for i := range rows {
+		rows[i] = []interface{}{
+			fmt.Sprintf("Some.Linux.Distribution.%d.iso", i), 1 << 30, fmt.Sprintf("%040X", i), "label",
+			"/downloads/temp/some-directory", 1, 1, 1500, 1600000000, 1600000000, 1600000000,
+		}
+	}
+	var b bytes.Buffer
+	Marshal(&b, "", rows)
+	return b.Bytes()
+}
+
+// heapInUse returns the bytes currently allocated on the heap, after a garbage collection
+func heapInUse() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// BenchmarkUnmarshalMulticall and BenchmarkUnmarshalEachMulticall compare decoding a d.multicall2 response
+// on 10000 torrents as a whole with decoding it row by row. The peak-heap-B metric is the heap in use while
+// the last row is decoded, which is what makes a difference for big seedboxes.
+func BenchmarkUnmarshalMulticall(b *testing.B) {
+	data := multicallResponse(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		_, params, _, err := Unmarshal(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if i == 0 {
+			b.StopTimer()
+			peak = heapInUse()
+			b.StartTimer()
+		}
+		runtime.KeepAlive(params)
+	}
+	b.ReportMetric(float64(peak), "peak-heap-B")
+}
+
+func BenchmarkUnmarshalEachMulticall(b *testing.B) {
+	data := multicallResponse(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		rows := 0
+		_, err := UnmarshalEach(bytes.NewReader(data), func(elem interface{}) error {
+			rows++
+			if i == 0 && rows == 10000 {
+				b.StopTimer()
+				peak = heapInUse()
+				b.StartTimer()
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(peak), "peak-heap-B")
+}
@@ -0,0 +1,338 @@
+// Package xmlrpctest records the calls of an xmlrpc.Client to cassettes and replays them, so tests can run offline
+// against the behavior of a real server captured once.
+//
+// A Recorder is an http.RoundTripper, plug it into a client with WithHTTPClient or NewClientWithHTTPClient:
+//  mode := xmlrpctest.Replay
+//  if os.Getenv("RECORD") != "" {
+//      mode = xmlrpctest.Record
+//  }
+//  rec, err := xmlrpctest.NewRecorder("testdata/rtorrent.json", mode)
+//  ...
+//  defer rec.Save()
+//  client := rtorrent.New(addr, false).WithHTTPClient(rec.Client())
+//
+// Calls are matched by codec, method name and arguments. Identical calls are replayed in the order they were
+// recorded, each recording once, so a torrent can be seen stopped and then started. A call which has no
+// recording left fails with an *UnmatchedError. JSON-RPC responses are replayed with the id of the request.
+package xmlrpctest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
+	"github.com/pkg/errors"
+)
+
+// Mode tells a Recorder whether to record or to replay calls
+type Mode int
+
+const (
+	// Replay answers calls from the cassette without any network access
+	Replay Mode = iota
+	// Record sends calls to the server and records them, Save writes the cassette
+	Record
+)
+
+// Recorder is an http.RoundTripper which records XMLRPC and JSON-RPC calls to a cassette file or replays them
+type Recorder struct {
+	// Transport sends the calls while recording, http.DefaultTransport if nil.
+	// Use an xmlrpc.SCGITransport to record from an SCGI socket.
+	Transport http.RoundTripper
+
+	path string
+	mode Mode
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	played       []bool
+}
+
+// Interaction is a recorded call and its response
+type Interaction struct {
+	// Codec is "xml" or "json"
+	Codec string `json:"codec"`
+	// Method is the name of the called method
+	Method string `json:"method"`
+	// Args are the arguments of the call, as JSON
+	Args json.RawMessage `json:"args"`
+	// Request is the body of the request
+	Request string `json:"request"`
+	// Response is the response of the server
+	Response Response `json:"response"`
+}
+
+// Response is a recorded HTTP response
+type Response struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int `json:"status_code"`
+	// ContentType is the Content-Type header of the response
+	ContentType string `json:"content_type,omitempty"`
+	// Body is the body of the response, decompressed
+	Body string `json:"body"`
+}
+
+// cassette is the content of a cassette file
+type cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// UnmatchedError is returned for calls which have no recording left in the cassette
+type UnmatchedError struct {
+	// Codec is "xml" or "json"
+	Codec string
+	// Method is the name of the called method
+	Method string
+	// Args are the arguments of the call, as JSON
+	Args string
+}
+
+func (e *UnmatchedError) Error() string {
+	return fmt.Sprintf("no recorded %s call of %s with args %s", e.Codec, e.Method, e.Args)
+}
+
+// NewRecorder returns a Recorder for the cassette at path.
+// In Replay mode the cassette is loaded and must exist, in Record mode it is created or replaced by Save.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{path: path, mode: mode}
+	if mode != Replay {
+		return r, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cassette")
+	}
+	var c cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse cassette %s", path)
+	}
+	for _, in := range c.Interactions {
+		// the args are compared as compact JSON
+		var b bytes.Buffer
+		if err := json.Compact(&b, in.Args); err != nil {
+			return nil, errors.Wrapf(err, "invalid args of %s in cassette %s", in.Method, path)
+		}
+		in.Args = b.Bytes()
+	}
+	r.interactions = c.Interactions
+	r.played = make([]bool, len(c.Interactions))
+	return r, nil
+}
+
+// Client returns an http.Client which sends its requests through the Recorder
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Interactions returns the calls recorded or loaded so far
+func (r *Recorder) Interactions() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Interaction(nil), r.interactions...)
+}
+
+// Unplayed returns the recorded calls which have not been replayed, e.g. to check that a test made all of them
+func (r *Recorder) Unplayed() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unplayed []*Interaction
+	for i, in := range r.interactions {
+		if !r.played[i] {
+			unplayed = append(unplayed, in)
+		}
+	}
+	return unplayed
+}
+
+// Save writes the recorded calls to the cassette, creating its directory if needed. It does nothing in Replay mode.
+func (r *Recorder) Save() error {
+	if r.mode != Record {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(cassette{Interactions: r.interactions}, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to encode cassette")
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return errors.Wrap(err, "failed to create cassette directory")
+	}
+	return errors.Wrap(ioutil.WriteFile(r.path, append(data, '\n'), 0644), "failed to write cassette")
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req.Body, req.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read request")
+	}
+	codec, method, args, err := parseCall(req.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == Replay {
+		return r.replay(req, body, codec, method, args)
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	out := req.Clone(req.Context())
+	out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	out.Header.Del("Content-Encoding")
+	// record the responses uncompressed, so cassettes can be read and edited
+	out.Header.Del("Accept-Encoding")
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(resp.Body, resp.Header.Get("Content-Encoding"))
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response")
+	}
+
+	in := &Interaction{
+		Codec:   codec,
+		Method:  method,
+		Args:    args,
+		Request: string(body),
+		Response: Response{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        string(respBody),
+		},
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.played = append(r.played, true)
+	r.mu.Unlock()
+	return in.Response.toHTTP(req), nil
+}
+
+// replay answers a call with the first of its recordings which was not played yet
+func (r *Recorder) replay(req *http.Request, body []byte, codec, method string, args json.RawMessage) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.interactions {
+		if r.played[i] || in.Codec != codec || in.Method != method || !bytes.Equal(in.Args, args) {
+			continue
+		}
+		r.played[i] = true
+		resp := in.Response
+		if codec == "json" {
+			// clients check the response to carry the id of their request, which differs from the recorded one
+			resp.Body = withRequestID(resp.Body, body)
+		}
+		return resp.toHTTP(req), nil
+	}
+	return nil, &UnmatchedError{Codec: codec, Method: method, Args: string(args)}
+}
+
+// withRequestID returns the JSON-RPC response body with the id of the request body, or as is if either is invalid
+func withRequestID(respBody string, reqBody []byte) string {
+	var req struct {
+		ID json.RawMessage `json:"id"`
+	}
+	var resp map[string]json.RawMessage
+	if json.Unmarshal(reqBody, &req) != nil || req.ID == nil || json.Unmarshal([]byte(respBody), &resp) != nil {
+		return respBody
+	}
+	resp["id"] = req.ID
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return respBody
+	}
+	return string(b)
+}
+
+func (resp Response) toHTTP(req *http.Request) *http.Response {
+	header := http.Header{}
+	if resp.ContentType != "" {
+		header.Set("Content-Type", resp.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}
+}
+
+// readBody reads a request or response body, decompressing it if needed
+func readBody(body io.ReadCloser, encoding string) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	var r io.Reader = body
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	default:
+		return nil, errors.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	return ioutil.ReadAll(r)
+}
+
+// parseCall returns the codec, the method name and the args as compact JSON of a request body
+func parseCall(contentType string, body []byte) (codec, method string, args json.RawMessage, err error) {
+	var params interface{}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); strings.Contains(mediaType, "json") {
+		codec = "json"
+		var req struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return "", "", nil, errors.Wrap(err, "failed to parse JSON-RPC request")
+		}
+		method = req.Method
+		if len(req.Params) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(req.Params))
+			// keep numbers as they were sent
+			dec.UseNumber()
+			if err := dec.Decode(&params); err != nil {
+				return "", "", nil, errors.Wrap(err, "failed to parse JSON-RPC params")
+			}
+		}
+	} else {
+		codec = "xml"
+		var xmlParams []interface{}
+		method, xmlParams, _, err = xmlrpc.Unmarshal(bytes.NewReader(body))
+		if err != nil {
+			return "", "", nil, errors.Wrap(err, "failed to parse XMLRPC request")
+		}
+		params = xmlParams
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+	args, err = json.Marshal(params)
+	if err != nil {
+		return "", "", nil, errors.Wrapf(err, "failed to encode args of %s", method)
+	}
+	return codec, method, args, nil
+}
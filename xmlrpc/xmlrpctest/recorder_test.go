@@ -0,0 +1,89 @@
+package xmlrpctest
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrobinsn/go-rtorrent/xmlrpc"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	srv := xmlrpc.NewServer()
+	count := 0
+	require.NoError(t, srv.Register("counter.next", func(step int) int {
+		count += step
+		return count
+	}))
+	require.NoError(t, srv.Register("d.name", func(hash string) (string, error) {
+		if hash != "ABC" {
+			return "", &xmlrpc.Fault{Code: -501, Message: "Could not find info-hash."}
+		}
+		return "Some.Linux.Distribution.iso", nil
+	}))
+	ts := httptest.NewServer(srv)
+	path := filepath.Join(t.TempDir(), "testdata", "cassette.json")
+
+	// calls made against the server and while replaying
+	run := func(t *testing.T, rec *Recorder) {
+		for _, codec := range []xmlrpc.Codec{xmlrpc.XMLCodec, xmlrpc.JSONCodec} {
+			client := xmlrpc.NewClientWithHTTPClient(ts.URL, rec.Client(), xmlrpc.WithCodec(codec))
+			result, err := client.Call("d.name", "ABC")
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{"Some.Linux.Distribution.iso"}, result)
+
+			_, err = client.Call("d.name", "XYZ")
+			var fault *xmlrpc.Fault
+			require.True(t, errors.As(err, &fault), "unexpected error: %v", err)
+			require.Equal(t, -501, fault.Code)
+		}
+		client := xmlrpc.NewClientWithHTTPClient(ts.URL, rec.Client())
+		for _, want := range []int{1, 2, 4} {
+			result, err := client.Call("counter.next", want/2+want%2)
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{want}, result)
+		}
+	}
+
+	rec, err := NewRecorder(path, Record)
+	require.NoError(t, err)
+	run(t, rec)
+	require.NoError(t, rec.Save())
+	require.Len(t, rec.Interactions(), 7)
+	ts.Close()
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "Some.Linux.Distribution.iso")
+
+	rec, err = NewRecorder(path, Replay)
+	require.NoError(t, err)
+	require.Len(t, rec.Unplayed(), 7)
+	run(t, rec)
+	require.Empty(t, rec.Unplayed())
+
+	// every recording is played once
+	client := xmlrpc.NewClientWithHTTPClient(ts.URL, rec.Client())
+	_, err = client.Call("counter.next", 1)
+	var unmatched *UnmatchedError
+	require.True(t, errors.As(err, &unmatched), "unexpected error: %v", err)
+	require.Equal(t, &UnmatchedError{Codec: "xml", Method: "counter.next", Args: "[1]"}, unmatched)
+
+	rec, err = NewRecorder(path, Replay)
+	require.NoError(t, err)
+	client = xmlrpc.NewClientWithHTTPClient(ts.URL, rec.Client())
+	_, err = client.Call("d.name", "DEF")
+	require.True(t, errors.As(err, &unmatched), "unexpected error: %v", err)
+	require.Equal(t, `["DEF"]`, unmatched.Args)
+	// saving in replay mode leaves the cassette alone
+	require.NoError(t, rec.Save())
+	replayed, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, replayed)
+
+	_, err = NewRecorder(filepath.Join(t.TempDir(), "missing.json"), Replay)
+	require.Error(t, err)
+}